@@ -0,0 +1,470 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateFrom reconciles the node with the given value (usually a struct
+// that was previously decoded from this node using To()). Unlike Set(),
+// which replaces the entire subtree, only scalars that differ are
+// changed, and keys and list items are added or removed as needed. The
+// comments, key order and styles of untouched nodes are preserved.
+// Missing keys are not added if their value is null (e.g. a nil
+// pointer), and all spellings of null ("", "~", "null") are equal.
+// Unchanged list items are matched by their value, so removing an item
+// does not move the comments of the following items.
+// Aliases and merge keys ("<<: *base") are kept as long as the values
+// they resolve to do not change.
+func (n *node) UpdateFrom(value interface{}) error {
+	desired, err := createNode(value)
+	if err != nil {
+		return err
+	}
+
+	return n.tree.changeAt(n.node, nil, changeInPlace, func() error {
+		var r reconciler
+		r.node(nil, n.node, desired)
+		n.tree.keyIndex().reset()
+
+		return nil
+	})
+}
+
+// reconciler updates nodes in-place. If record is true, all changes are
+// also turned into operations, so that a small change in a large
+// document does not require copying the entire document.
+type reconciler struct {
+	record bool
+	ops    []operation
+}
+
+func (r *reconciler) child(path Path, step Step) Path {
+	if !r.record {
+		return nil
+	}
+
+	return append(copyPath(path), step)
+}
+
+// replaced records that the node at the path was changed in-place; old
+// must not share any children with the changed node.
+func (r *reconciler) replaced(path Path, old *yaml.Node, current *yaml.Node) {
+	if r.record {
+		r.ops = append(r.ops, operation{
+			kind:     opReplace,
+			path:     copyPath(path),
+			oldValue: old,
+			newValue: cloneNode(current),
+		})
+	}
+}
+
+func (r *reconciler) inserted(path Path, index int, key *yaml.Node, value *yaml.Node) {
+	if r.record {
+		r.ops = append(r.ops, operation{
+			kind:     opInsert,
+			path:     path,
+			index:    index,
+			key:      cloneNode(key),
+			newValue: cloneNode(value),
+		})
+	}
+}
+
+// removed records the removal of an item; the removed nodes are
+// detached from the tree and not cloned.
+func (r *reconciler) removed(path Path, index int, key *yaml.Node, value *yaml.Node) {
+	if r.record {
+		r.ops = append(r.ops, operation{
+			kind:     opRemove,
+			path:     path,
+			index:    index,
+			key:      key,
+			oldValue: value,
+		})
+	}
+}
+
+func (r *reconciler) node(path Path, current *yaml.Node, desired *yaml.Node) {
+	// aliases are only expanded if their value changed
+	if current.Kind == yaml.AliasNode {
+		if !valueEqual(current, desired) {
+			r.replace(path, current, desired)
+		}
+
+		return
+	}
+
+	if current.Kind != desired.Kind {
+		r.replace(path, current, desired)
+		return
+	}
+
+	switch current.Kind {
+	case yaml.ScalarNode:
+		r.scalar(path, current, desired)
+	case yaml.MappingNode:
+		r.mapping(path, current, desired)
+	case yaml.SequenceNode:
+		r.sequence(path, current, desired)
+	}
+}
+
+// replace overwrites the node, but keeps its comments.
+func (r *reconciler) replace(path Path, current *yaml.Node, desired *yaml.Node) {
+	old := *current
+	replaceKeepingComments(current, desired)
+	r.replaced(path, &old, current)
+}
+
+func (r *reconciler) scalar(path Path, current *yaml.Node, desired *yaml.Node) {
+	if jsonTypeOf(current) == jsonTypeOf(desired) && jsonEqual(current, desired) {
+		return
+	}
+
+	old := *current
+
+	// keep quoting and block styles for strings, unless the new
+	// value requires a specific style
+	keepStyle := current.ShortTag() == "!!str" && desired.ShortTag() == "!!str" && current.Style != 0
+	if !keepStyle {
+		current.Style = desired.Style
+	}
+
+	current.Tag = desired.Tag
+	current.Value = desired.Value
+
+	r.replaced(path, &old, current)
+}
+
+func (r *reconciler) mapping(path Path, current *yaml.Node, desired *yaml.Node) {
+	wanted := map[string]bool{}
+	for i := 0; i+1 < len(desired.Content); i += 2 {
+		wanted[desired.Content[i].Value] = true
+	}
+
+	// keys inherited via merge keys ("<<: *base") cannot be removed
+	// individually, so the merge keys have to be expanded first
+	merged := mergedEntries(current)
+	inherited := make(map[string]*yaml.Node, len(merged))
+
+	for _, e := range merged {
+		if !wanted[e.key] {
+			var old *yaml.Node
+			if r.record {
+				old = cloneNode(current)
+			}
+
+			expandMergeKeys(current, merged)
+			r.replaced(path, old, current)
+
+			inherited = nil
+			break
+		}
+
+		inherited[e.key] = e.value
+	}
+
+	// insert new keys after the previous key, to follow the
+	// order of the desired value as closely as possible
+	insertAt := 0
+
+	for i := 0; i+1 < len(desired.Content); i += 2 {
+		key := desired.Content[i]
+
+		idx := findKey(current, key.Value, nil)
+		if idx >= 0 {
+			r.node(r.child(path, keyStep(current.Content[idx])), current.Content[idx+1], desired.Content[i+1])
+			insertAt = idx + 2
+			continue
+		}
+
+		// unchanged inherited values stay inherited, changed ones
+		// are overridden by an explicit key
+		if value, ok := inherited[key.Value]; ok && valueEqual(value, desired.Content[i+1]) {
+			continue
+		}
+
+		// missing keys are decoded as null values (e.g. nil pointers),
+		// so adding them would change the document without need
+		if jsonTypeOf(desired.Content[i+1]) == "null" {
+			continue
+		}
+
+		content := make([]*yaml.Node, 0, len(current.Content)+2)
+		content = append(content, current.Content[:insertAt]...)
+		content = append(content, key, desired.Content[i+1])
+		content = append(content, current.Content[insertAt:]...)
+
+		current.Content = content
+		r.inserted(r.child(path, keyStep(key)), insertAt, key, desired.Content[i+1])
+		insertAt += 2
+	}
+
+	for i := 0; i+1 < len(current.Content); {
+		if key := current.Content[i]; key.Kind == yaml.ScalarNode && !isMergeKey(key) && !wanted[key.Value] {
+			r.removed(r.child(path, keyStep(key)), i, key, current.Content[i+1])
+			current.Content = append(current.Content[:i], current.Content[i+2:]...)
+		} else {
+			i += 2
+		}
+	}
+}
+
+// sequence matches items that are unchanged, so that removing or
+// inserting an item does not move the comments of the following items.
+// Between unchanged items, the remaining items are reconciled in order
+// and surplus items are removed or inserted.
+func (r *reconciler) sequence(path Path, current *yaml.Node, desired *yaml.Node) {
+	matches := matchItems(current.Content, desired.Content)
+
+	// pos is the index in the current sequence, which changes as items
+	// are removed and inserted, so the recorded operations stay valid
+	pos := 0
+	from, to := 0, 0
+
+	for _, m := range append(matches, [2]int{len(current.Content), len(desired.Content)}) {
+		for ; from < m[0] && to < m[1]; from, to = from+1, to+1 {
+			r.node(r.child(path, pos), current.Content[pos], desired.Content[to])
+			pos++
+		}
+
+		for ; from < m[0]; from++ {
+			r.removed(r.child(path, pos), pos, nil, current.Content[pos])
+			current.Content = append(current.Content[:pos], current.Content[pos+1:]...)
+		}
+
+		for ; to < m[1]; to++ {
+			item := desired.Content[to]
+
+			content := make([]*yaml.Node, 0, len(current.Content)+1)
+			content = append(content, current.Content[:pos]...)
+			content = append(content, item)
+			content = append(content, current.Content[pos:]...)
+
+			current.Content = content
+			r.inserted(r.child(path, pos), pos, nil, item)
+			pos++
+		}
+
+		// skip the unchanged item
+		from, to = from+1, to+1
+		pos++
+	}
+}
+
+// matchItems returns the index pairs of the longest common subsequence
+// of unchanged items. Common prefixes and suffixes are matched first, so
+// that the common case of few changes does not compare all items.
+func matchItems(current []*yaml.Node, desired []*yaml.Node) [][2]int {
+	var prefix, suffix [][2]int
+
+	for len(prefix) < len(current) && len(prefix) < len(desired) && valueEqual(current[len(prefix)], desired[len(prefix)]) {
+		prefix = append(prefix, [2]int{len(prefix), len(prefix)})
+	}
+
+	start := len(prefix)
+	endA, endB := len(current), len(desired)
+
+	for endA > start && endB > start && valueEqual(current[endA-1], desired[endB-1]) {
+		endA--
+		endB--
+		suffix = append([][2]int{{endA, endB}}, suffix...)
+	}
+
+	// lengths[i][j] is the length of the longest common subsequence of
+	// current[start+i:endA] and desired[start+j:endB]
+	a, b := current[start:endA], desired[start:endB]
+
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case valueEqual(a[i], b[j]):
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	matches := prefix
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case valueEqual(a[i], b[j]):
+			matches = append(matches, [2]int{start + i, start + j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return append(matches, suffix...)
+}
+
+// replaceKeepingComments overwrites the node, but keeps its comments.
+func replaceKeepingComments(dst *yaml.Node, src *yaml.Node) {
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+
+	shallowCopyNode(dst, *src)
+
+	dst.HeadComment = head
+	dst.LineComment = line
+	dst.FootComment = foot
+}
+
+// valueEqual compares the values of two nodes like reconcileNode does,
+// resolving aliases and merge keys.
+func valueEqual(a *yaml.Node, b *yaml.Node) bool {
+	a = resolveAlias(a)
+	b = resolveAlias(b)
+
+	if a.Kind != b.Kind {
+		return false
+	}
+
+	switch a.Kind {
+	case yaml.MappingNode:
+		entriesA := effectiveEntries(a)
+		entriesB := effectiveEntries(b)
+		if len(entriesA) != len(entriesB) {
+			return false
+		}
+
+		values := make(map[string]*yaml.Node, len(entriesB))
+		for _, e := range entriesB {
+			values[e.key] = e.value
+		}
+
+		for _, e := range entriesA {
+			value, ok := values[e.key]
+			if !ok || !valueEqual(e.value, value) {
+				return false
+			}
+		}
+
+		return true
+
+	case yaml.SequenceNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+
+		for i := range a.Content {
+			if !valueEqual(a.Content[i], b.Content[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	default:
+		return jsonTypeOf(a) == jsonTypeOf(b) && jsonEqual(a, b)
+	}
+}
+
+type mappingEntry struct {
+	key   string
+	value *yaml.Node
+}
+
+// isMergeKey returns true for "<<" keys, which merge other mappings
+// into the mapping containing them.
+func isMergeKey(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Value == "<<" && n.ShortTag() == "!!merge"
+}
+
+// mergedEntries returns all entries that a mapping inherits via merge
+// keys and does not override, in the order they are merged.
+func mergedEntries(mapping *yaml.Node) []mappingEntry {
+	var entries []mappingEntry
+
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if key := mapping.Content[i]; !isMergeKey(key) {
+			seen[key.Value] = true
+		}
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if !isMergeKey(mapping.Content[i]) {
+			continue
+		}
+
+		// earlier mappings in a list of merged mappings take precedence
+		sources := []*yaml.Node{mapping.Content[i+1]}
+		if value := resolveAlias(mapping.Content[i+1]); value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+
+		for _, source := range sources {
+			if source = resolveAlias(source); source.Kind != yaml.MappingNode {
+				continue
+			}
+
+			for _, e := range effectiveEntries(source) {
+				if !seen[e.key] {
+					seen[e.key] = true
+					entries = append(entries, e)
+				}
+			}
+		}
+	}
+
+	return entries
+}
+
+// effectiveEntries returns all entries of a mapping, including the ones
+// inherited via merge keys.
+func effectiveEntries(mapping *yaml.Node) []mappingEntry {
+	entries := mergedEntries(mapping)
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if key := mapping.Content[i]; !isMergeKey(key) {
+			entries = append(entries, mappingEntry{key: key.Value, value: mapping.Content[i+1]})
+		}
+	}
+
+	return entries
+}
+
+// expandMergeKeys replaces the merge keys of the mapping with copies of
+// the inherited entries.
+func expandMergeKeys(mapping *yaml.Node, inherited []mappingEntry) {
+	content := make([]*yaml.Node, 0, len(mapping.Content)+2*len(inherited))
+	expanded := false
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := mapping.Content[i]
+		if !isMergeKey(key) {
+			content = append(content, key, mapping.Content[i+1])
+			continue
+		}
+
+		if !expanded {
+			for _, e := range inherited {
+				value := cloneNode(e.value)
+				value.Anchor = ""
+
+				content = append(content, stringNode(e.key), value)
+			}
+
+			expanded = true
+		}
+	}
+
+	mapping.Content = content
+}
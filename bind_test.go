@@ -0,0 +1,371 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testBindConfig struct {
+	Name     string            `yaml:"name"`
+	Version  string            `yaml:"version"`
+	Replicas int               `yaml:"replicas"`
+	Debug    bool              `yaml:"debug,omitempty"`
+	Ports    []int             `yaml:"ports"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+}
+
+func TestUpdateFrom(t *testing.T) {
+	input := strings.TrimSpace(`
+# application config
+name: web # the name
+version: "1.0"
+# scaling
+replicas: 0x2
+debug: true
+ports: [80, 443]
+labels:
+  # the team
+  team: a
+  tier: frontend
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var config testBindConfig
+	if err := doc.To(&config); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+
+	// no changes should not alter anything
+	if err := doc.UpdateFrom(config); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, input)
+
+	config.Version = "1.1"
+	config.Debug = false
+	config.Ports = []int{80, 8080, 9090}
+	delete(config.Labels, "tier")
+	config.Labels["zone"] = "eu"
+
+	if err := doc.UpdateFrom(config); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, `
+# application config
+name: web # the name
+version: "1.1"
+# scaling
+replicas: 0x2
+ports: [80, 8080, 9090]
+labels:
+  # the team
+  team: a
+  zone: eu
+`)
+}
+
+func TestUpdateFromNullValues(t *testing.T) {
+	type config struct {
+		Name     *string     `yaml:"name"`
+		Value    interface{} `yaml:"value"`
+		Tag      *string     `yaml:"tag"`
+		Optional *int        `yaml:"optional"`
+	}
+
+	input := strings.TrimSpace(`
+name:
+value: ~
+tag: null
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var c config
+	if err := doc.To(&c); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+
+	// a round trip must not change anything, even though the null values
+	// are encoded differently and missing keys are decoded as nil
+	if err := doc.UpdateFrom(c); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, input)
+
+	one := 1
+	c.Optional = &one
+
+	if err := doc.UpdateFrom(c); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, `
+name:
+value: ~
+tag: null
+optional: 1
+`)
+}
+
+func TestUpdateFromRecordsChanges(t *testing.T) {
+	input := strings.TrimSpace(`
+name: web
+version: "1.0"
+replicas: 2
+ports: [80, 443]
+labels:
+  team: a
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var config testBindConfig
+	if err := doc.To(&config); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	var changes []string
+	doc.Observe(func(c Change) error {
+		changes = append(changes, fmt.Sprintf("%v %v", c.Kind, c.Path))
+		return nil
+	})
+
+	config.Replicas = 3
+	config.Ports = []int{80}
+	config.Labels["zone"] = "eu"
+
+	if err := doc.UpdateFrom(config); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	// only the changed nodes are recorded, not the entire document
+	expected := []string{"replace replicas", "remove ports.[1]", "insert labels.zone"}
+	if strings.Join(changes, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected changes %v, but got %v.", expected, changes)
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	expectYAML(t, node, input)
+}
+
+func TestUpdateFromKindChange(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+value: foo
+other: [1, 2, 3]
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.MustGet("value").UpdateFrom([]string{"a"}); err != nil {
+		t.Fatalf("Failed to update node: %v", err)
+	}
+
+	if err := doc.MustGet("other").UpdateFrom([]int{1}); err != nil {
+		t.Fatalf("Failed to update node: %v", err)
+	}
+
+	expectYAML(t, node, `
+value:
+  - a
+other: [1]
+`)
+}
+
+func TestUpdateFromInsertsKeysInOrder(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+name: web
+ports: [80]
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.UpdateFrom(testBindConfig{Name: "web", Version: "2", Ports: []int{80}}); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, `
+name: web
+version: "2"
+replicas: 0
+ports: [80]
+`)
+}
+
+func TestUpdateFromAnchors(t *testing.T) {
+	input := strings.TrimSpace(`
+base: &base
+  a: 1
+  tags: &tags [x, y]
+svc:
+  <<: *base
+  b: 2
+  labels: *tags
+`)
+
+	type service struct {
+		A      int      `yaml:"a"`
+		B      int      `yaml:"b"`
+		Tags   []string `yaml:"tags"`
+		Labels []string `yaml:"labels"`
+	}
+
+	type config struct {
+		Base map[string]interface{} `yaml:"base"`
+		Svc  service                `yaml:"svc"`
+	}
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var cfg config
+	if err := doc.To(&cfg); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	// yaml.v3 writes merge keys as "!!merge <<"
+	before := yamlEncode(t, node)
+
+	// no changes should not alter anything, not even the aliases
+	if err := doc.UpdateFrom(cfg); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, before)
+
+	if doc.CanUndo() {
+		t.Fatal("Unchanged document should not have recorded a change.")
+	}
+
+	// changing an inherited value overrides it
+	cfg.Svc.A = 3
+	cfg.Svc.Labels = []string{"z"}
+
+	if err := doc.UpdateFrom(cfg); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, `
+base: &base
+  a: 1
+  tags: &tags [x, y]
+svc:
+  a: 3
+  !!merge <<: *base
+  b: 2
+  labels:
+    - z
+`)
+}
+
+func TestUpdateFromExpandsMergeKeys(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+base: &base
+  a: 1
+  c: 3
+svc:
+  <<: *base
+  b: 2
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	// removing an inherited key is only possible by expanding the merge key
+	err = doc.UpdateFrom(map[string]interface{}{
+		"base": map[string]int{"a": 1, "c": 3},
+		"svc":  map[string]int{"a": 1, "b": 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, `
+base: &base
+  a: 1
+  c: 3
+svc:
+  a: 1
+  b: 2
+`)
+}
+
+func TestUpdateFromKeepsItemComments(t *testing.T) {
+	input := strings.TrimSpace(`
+items:
+  # first
+  - a # one
+  # second
+  - b # two
+  # third
+  - c # three
+  # fourth
+  - d # four
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	var changes []string
+	doc.Observe(func(c Change) error {
+		changes = append(changes, fmt.Sprintf("%v %v", c.Kind, c.Path))
+		return nil
+	})
+
+	// remove the first and a middle item and append a new one
+	desired := map[string][]string{"items": {"b", "d", "e"}}
+	if err := doc.UpdateFrom(desired); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	expectYAML(t, node, `
+items:
+  # second
+  - b # two
+  # fourth
+  - d # four
+  - e
+`)
+
+	expected := []string{"remove items.[0]", "remove items.[1]", "insert items.[2]"}
+	if strings.Join(changes, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected changes %v, but got %v.", expected, changes)
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	expectYAML(t, node, input)
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Blank lines before an entry are stored as leading line breaks in the
+// head comment of its key (or of the item itself for sequences), which
+// yaml.v3 renders as empty lines. This way they survive cloning, undo
+// and all other operations that keep comments. The HeadComment()
+// accessors hide them and the setters keep them, so they are only
+// changed using SetBlankLinesBefore().
+
+// blankLines returns the number of blank lines stored in a head comment.
+func blankLines(comment string) int {
+	return len(comment) - len(strings.TrimLeft(comment, "\n"))
+}
+
+// headComment returns the head comment without the blank lines before
+// it.
+func headComment(comment string) string {
+	return strings.TrimLeft(comment, "\n")
+}
+
+// withBlankLines returns the comment with exactly count blank lines
+// before it.
+func withBlankLines(comment string, count int) string {
+	return strings.Repeat("\n", count) + strings.TrimLeft(comment, "\n")
+}
+
+// detectBlankLines stores the number of blank lines in the source before
+// each mapping entry and sequence item in the decoded document.
+func detectBlankLines(source []byte, doc *yaml.Node) {
+	lines := bytes.Split(source, []byte("\n"))
+
+	// keeping chomping ("|+") makes trailing blank lines part of a block
+	// scalar, which yaml.v3 already writes back
+	var previous *yaml.Node
+
+	annotate := func(entry *yaml.Node, head string) {
+		if previous != nil && previous.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && strings.HasSuffix(previous.Value, "\n\n") {
+			return
+		}
+
+		start := entry.Line
+		if head != "" {
+			start -= strings.Count(head, "\n") + 1
+		}
+
+		count := 0
+		line := start - 1
+		for line >= 1 && line <= len(lines) && isBlankLine(lines[line-1]) {
+			count++
+			line--
+		}
+
+		// blank lines at the beginning of the document are lost
+		if line < 1 {
+			return
+		}
+
+		// yaml.v3 always adds a blank line after foot comments and the
+		// document's head comment
+		if bytes.HasPrefix(bytes.TrimSpace(lines[line-1]), []byte("#")) {
+			count--
+		}
+
+		if count > 0 {
+			entry.HeadComment = withBlankLines(entry.HeadComment, count)
+		}
+	}
+
+	// item is true if n is a sequence item, whose first entry shares the
+	// item's blank lines
+	var walk func(n *yaml.Node, item bool)
+	walk = func(n *yaml.Node, item bool) {
+		block := isBlock(n)
+
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, child := range n.Content {
+				walk(child, false)
+			}
+
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if block && (i > 0 || !item) {
+					annotate(n.Content[i], n.Content[i].HeadComment)
+				}
+
+				walk(n.Content[i+1], false)
+			}
+
+		case yaml.SequenceNode:
+			for i, child := range n.Content {
+				if block && (i > 0 || !item) {
+					head := child.HeadComment
+					if head == "" && child.Kind == yaml.MappingNode && len(child.Content) > 0 {
+						// for "- # comment", the comment is on the first key
+						head = child.Content[0].HeadComment
+					}
+
+					annotate(child, head)
+				}
+
+				walk(child, true)
+			}
+
+		case yaml.ScalarNode:
+			previous = n
+		}
+	}
+
+	walk(doc, false)
+}
+
+// trimBlankLines removes the indentation yaml.v3 writes for blank lines
+// in nested collections. The encoder never produces lines consisting
+// only of whitespace inside of scalars, so these are always blank lines.
+func trimBlankLines(encoded []byte) []byte {
+	lines := bytes.SplitAfter(encoded, []byte("\n"))
+	for i, line := range lines {
+		if len(line) > 1 && isBlankLine(line) {
+			lines[i] = []byte("\n")
+		}
+	}
+
+	return bytes.Join(lines, nil)
+}
+
+// blankLinesTarget returns the node whose head comment stores the blank
+// lines before the entry at the given path.
+func (n *node) blankLinesTarget(path Path) (*yaml.Node, error) {
+	parent, index, err := n.entry(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 {
+		return nil, fmt.Errorf("path %q not found", path.String())
+	}
+
+	return parent.node.Content[index], nil
+}
+
+// BlankLinesBefore returns the number of blank lines before the mapping
+// entry or sequence item at the given path, or 0 if it does not exist.
+func (n *node) BlankLinesBefore(path Path) int {
+	target, err := n.blankLinesTarget(path)
+	if err != nil {
+		return 0
+	}
+
+	return blankLines(target.HeadComment)
+}
+
+// SetBlankLinesBefore sets the number of blank lines before the mapping
+// entry or sequence item at the given path, for example to separate a
+// newly added section from the previous one. Blank lines are not
+// rendered inside flow collections.
+func (n *node) SetBlankLinesBefore(path Path, count int) error {
+	if count < 0 {
+		return errors.New("number of blank lines must be >= 0")
+	}
+
+	target, err := n.blankLinesTarget(path)
+	if err != nil {
+		return err
+	}
+
+	n.tree.setComment(target, CommentHead, withBlankLines(target.HeadComment, count))
+
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Document
+
+func (d *document) BlankLinesBefore(path Path) int {
+	root, err := d.RootNode()
+	if err != nil {
+		return 0
+	}
+
+	return root.BlankLinesBefore(path)
+}
+
+func (d *document) SetBlankLinesBefore(path Path, count int) error {
+	root, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	return root.SetBlankLinesBefore(path, count)
+}
@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBlankLinesRoundtrip(t *testing.T) {
+	testcases := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "top-level sections",
+			input: "name: web\n\nserver:\n  port: 80\n\n\nlist:\n  - a\n",
+		},
+		{
+			name:  "document head comment",
+			input: "# head\n\nname: web\n\nport: 80\n",
+		},
+		{
+			name:  "section comments",
+			input: "name: web\n\n# Networking\nport: 80\nhost: localhost\n# end of networking\n\nlist:\n  - a\n",
+		},
+		{
+			name:  "nested entries",
+			input: "server:\n  port: 80\n\n  host: localhost\nlist:\n  - a\n\n  - b\n  - name: x\n\n  - name: y\n",
+		},
+		{
+			name:  "block scalars",
+			input: "script: |\n  echo hello\n\n  echo world\n\nkept: |+\n  text\n\nnext: value\n",
+		},
+		{
+			name:  "compact sequences",
+			input: "list:\n- a\n\n- b\nnext: value\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Load([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("Failed to load document: %v", err)
+			}
+
+			encoded, err := doc.Bytes(0)
+			if err != nil {
+				t.Fatalf("Failed to encode document: %v", err)
+			}
+
+			if string(encoded) != tc.input {
+				t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", tc.input, string(encoded))
+			}
+		})
+	}
+}
+
+func TestSetBlankLinesBefore(t *testing.T) {
+	doc, err := Load([]byte("name: web\n\n# the port\nport: 80\n"))
+	if err != nil {
+		t.Fatalf("Failed to load document: %v", err)
+	}
+
+	if count := doc.BlankLinesBefore(Path{"port"}); count != 1 {
+		t.Fatalf("Expected 1 blank line before port, but got %d.", count)
+	}
+
+	doc.EnableHistory()
+
+	if _, err := doc.SetAt(Path{"server", "host"}, "localhost"); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+
+	if err := doc.SetBlankLinesBefore(Path{"server"}, 1); err != nil {
+		t.Fatalf("Failed to set blank lines: %v", err)
+	}
+
+	if err := doc.SetBlankLinesBefore(Path{"port"}, 0); err != nil {
+		t.Fatalf("Failed to set blank lines: %v", err)
+	}
+
+	expected := "name: web\n# the port\nport: 80\n\nserver:\n  host: localhost\n"
+
+	encoded, err := doc.Bytes(0)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	if string(encoded) != expected {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expected, string(encoded))
+	}
+
+	key, _ := doc.GetKey("port")
+	if lines := key.CommentLines(CommentHead); strings.Join(lines, "|") != "the port" {
+		t.Fatalf("Unexpected head comment lines %q.", lines)
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	if count := doc.BlankLinesBefore(Path{"port"}); count != 1 {
+		t.Fatalf("Expected undo to restore 1 blank line before port, but got %d.", count)
+	}
+
+	if err := doc.SetBlankLinesBefore(Path{"missing"}, 1); err == nil {
+		t.Fatal("Expected error for missing path.")
+	}
+
+	if err := doc.SetBlankLinesBefore(Path{"port"}, -1); err == nil {
+		t.Fatal("Expected error for negative number of blank lines.")
+	}
+}
+
+func TestBlankLinesHeadComment(t *testing.T) {
+	doc, err := Load([]byte("a: 1\n\nb: 2\nlist:\n  - x\n\n  - y\n"))
+	if err != nil {
+		t.Fatalf("Failed to load document: %v", err)
+	}
+
+	key, ok := doc.GetKey("b")
+	if !ok {
+		t.Fatal("Failed to get key b.")
+	}
+
+	if comment := key.HeadComment(); comment != "" {
+		t.Fatalf("Expected no head comment, but got %q.", comment)
+	}
+
+	key.SetHeadComment("# b")
+
+	item := doc.MustGet("list", 1)
+	if comment := item.HeadComment(); comment != "" {
+		t.Fatalf("Expected no head comment, but got %q.", comment)
+	}
+
+	item.SetHeadComment("# y")
+
+	encoded, err := doc.Bytes(0)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	expected := "a: 1\n\n# b\nb: 2\nlist:\n  - x\n\n  # y\n  - y\n"
+	if string(encoded) != expected {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expected, string(encoded))
+	}
+}
+
+func TestHeadCommentLeadingLineBreaks(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte("# doc\n\n# key\nkey:\n  # item\n  - x\n"), &root); err != nil {
+		t.Fatalf("Failed to decode YAML: %v", err)
+	}
+
+	doc, err := NewDocument(&root)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+
+	// leading line breaks set directly on the yaml.Nodes are treated as
+	// blank lines; previously they were part of the returned comments
+	root.HeadComment = "\n" + root.HeadComment
+	root.Content[0].Content[0].HeadComment = "\n\n" + root.Content[0].Content[0].HeadComment
+	root.Content[0].Content[1].Content[0].HeadComment = "\n" + root.Content[0].Content[1].Content[0].HeadComment
+
+	key, ok := doc.GetKey("key")
+	if !ok {
+		t.Fatal("Failed to get key.")
+	}
+
+	item := doc.MustGet("key", 0)
+
+	testcases := []struct {
+		name     string
+		raw      string
+		comment  string
+		expected string
+	}{
+		{name: "document", raw: root.HeadComment, comment: doc.HeadComment(), expected: "# doc"},
+		{name: "key", raw: root.Content[0].Content[0].HeadComment, comment: key.HeadComment(), expected: "# key"},
+		{name: "item", raw: rawNode(item).HeadComment, comment: item.HeadComment(), expected: "# item"},
+	}
+
+	for _, tc := range testcases {
+		if tc.raw != "\n"+tc.expected && tc.raw != "\n\n"+tc.expected {
+			t.Fatalf("Expected raw %s comment to start with line breaks, but got %q.", tc.name, tc.raw)
+		}
+
+		if tc.comment != tc.expected {
+			t.Fatalf("Expected %s comment %q, but got %q.", tc.name, tc.expected, tc.comment)
+		}
+	}
+
+	// setting a comment keeps the line breaks instead of replacing them
+	doc.SetHeadComment("# new doc")
+	key.SetHeadComment("# new key")
+	item.SetHeadComment("# new item")
+
+	if comment := root.HeadComment; comment != "\n# new doc" {
+		t.Fatalf("Expected document comment %q, but got %q.", "\n# new doc", comment)
+	}
+
+	if comment := root.Content[0].Content[0].HeadComment; comment != "\n\n# new key" {
+		t.Fatalf("Expected key comment %q, but got %q.", "\n\n# new key", comment)
+	}
+
+	if comment := root.Content[0].Content[1].Content[0].HeadComment; comment != "\n# new item" {
+		t.Fatalf("Expected item comment %q, but got %q.", "\n# new item", comment)
+	}
+}
+
+func TestNewDocumentBlankLines(t *testing.T) {
+	input := "a: 1\n\nb: 2\n"
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(input), &node); err != nil {
+		t.Fatalf("Failed to decode YAML: %v", err)
+	}
+
+	doc, err := NewDocument(&node)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+
+	// without the source, blank lines cannot be detected
+	encoded, err := doc.Bytes(0)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	if expected := "a: 1\nb: 2\n"; string(encoded) != expected {
+		t.Fatalf("Expected %q, but got %q.", expected, string(encoded))
+	}
+
+	loaded, err := Load([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to load document: %v", err)
+	}
+
+	encoded, err = loaded.Bytes(0)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	if string(encoded) != input {
+		t.Fatalf("Expected %q, but got %q.", input, string(encoded))
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+func (n *node) Clone() Node {
+	return &node{
+		node: cloneNode(n.node),
+	}
+}
+
+func (d *document) Clone() Document {
+	clone := &document{
+		node:   cloneNode(d.node),
+		format: d.format,
+		tree: &tree{
+			duplicates: d.tree.duplicateKeyPolicy(),
+		},
+	}
+	clone.tree.doc = clone
+
+	if d.tree.keyIndex() != nil {
+		clone.EnableKeyIndex()
+	}
+
+	return clone
+}
+
+// cloneNode returns a deep copy of the given node. Aliases that point
+// to anchors within the cloned subtree are remapped to the copied
+// anchors; aliases pointing outside of it keep their original target.
+func cloneNode(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+
+	copies := map[*yaml.Node]*yaml.Node{}
+	cloned := cloneNodeRecursive(n, copies)
+	remapAliases(cloned, copies)
+
+	return cloned
+}
+
+func cloneNodeRecursive(n *yaml.Node, copies map[*yaml.Node]*yaml.Node) *yaml.Node {
+	cloned := &yaml.Node{}
+	shallowCopyNode(cloned, *n)
+	copies[n] = cloned
+
+	if n.Content != nil {
+		cloned.Content = make([]*yaml.Node, len(n.Content))
+		for i, child := range n.Content {
+			cloned.Content[i] = cloneNodeRecursive(child, copies)
+		}
+	}
+
+	return cloned
+}
+
+func remapAliases(n *yaml.Node, copies map[*yaml.Node]*yaml.Node) {
+	if n.Alias != nil {
+		if target, ok := copies[n.Alias]; ok {
+			n.Alias = target
+		}
+	}
+
+	for _, child := range n.Content {
+		remapAliases(child, copies)
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentClone(t *testing.T) {
+	input := strings.TrimSpace(`
+# head
+base: &base
+  # about x
+  x: 1 # one
+copy: *base
+list: [a, b]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	clone := doc.Clone()
+
+	if _, err := clone.SetAt(Path{"base", "x"}, 2); err != nil {
+		t.Fatalf("Failed to set value in clone: %v", err)
+	}
+
+	if _, err := clone.SetAt(Path{"list", 1}, "c"); err != nil {
+		t.Fatalf("Failed to set value in clone: %v", err)
+	}
+
+	clone.MustGet("base").SetHeadComment("changed")
+
+	expectYAML(t, node, input)
+
+	if rawNode(clone.MustGet("copy")).Alias != rawNode(clone.MustGet("base")) {
+		t.Fatal("Expected alias in clone to point to the cloned anchor.")
+	}
+
+	if rawNode(doc.MustGet("copy")).Alias != rawNode(doc.MustGet("base")) {
+		t.Fatal("Expected alias in original to be unchanged.")
+	}
+
+	if clone.Format() != doc.Format() {
+		t.Fatal("Expected clone to have the same format.")
+	}
+}
+
+func TestNodeClone(t *testing.T) {
+	input := strings.TrimSpace(`
+foo:
+  # comment
+  bar: [1, 2, 3]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	clone := doc.MustGet("foo").Clone()
+
+	if err := clone.DeleteKey("bar", 0); err != nil {
+		t.Fatalf("Failed to delete item in clone: %v", err)
+	}
+
+	expectYAML(t, node, input)
+
+	if !Equal(clone, loadRootNode(t, "# comment\nbar: [2, 3]"), SemanticEqual) {
+		t.Fatalf("Clone was not modified correctly, got:\n%s", clone.String())
+	}
+}
@@ -0,0 +1,517 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.xrstf.de/yamled"
+	"gopkg.in/yaml.v3"
+)
+
+func newFlagSet(name string, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: yamled %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// optionalFile returns the filename at the given position or ""
+// for stdin.
+func optionalFile(args []string, pos int) string {
+	if len(args) > pos {
+		return args[pos]
+	}
+
+	return ""
+}
+
+/////////////////////////////////////////////////////////////////////
+// get
+
+func runGet(args []string, stdin io.Reader, stdout io.Writer) error {
+	var flags commonFlags
+
+	fs := newFlagSet("get", "PATH [FILE]")
+	flags.add(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	path, err := yamled.ParsePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	s, err := loadStream(optionalFile(fs.Args(), 1), stdin)
+	if err != nil {
+		return err
+	}
+
+	docs, err := s.selected(flags)
+	if err != nil {
+		return err
+	}
+
+	found := false
+
+	for _, doc := range docs {
+		node, ok := getNode(doc, path)
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		if node.Kind() == yaml.ScalarNode {
+			fmt.Fprintln(stdout, node.ToString())
+			continue
+		}
+
+		indent := flags.indent
+		if indent == 0 {
+			indent = doc.Format().Indent
+		}
+
+		encoded, err := node.Bytes(indent)
+		if err != nil {
+			return err
+		}
+
+		if _, err := stdout.Write(encoded); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("path %q not found", fs.Arg(0))
+	}
+
+	return nil
+}
+
+func getNode(doc yamled.Document, path yamled.Path) (yamled.Node, bool) {
+	if len(path) == 0 {
+		root, err := doc.RootNode()
+		return root, err == nil
+	}
+
+	return doc.Get(path...)
+}
+
+/////////////////////////////////////////////////////////////////////
+// set
+
+func runSet(args []string, stdin io.Reader, stdout io.Writer) error {
+	var (
+		flags     commonFlags
+		valueType string
+	)
+
+	fs := newFlagSet("set", "PATH VALUE [FILE]")
+	flags.add(fs)
+	fs.StringVar(&valueType, "type", "string", "Type of the value, one of string, int, float, bool, null, yaml or json.")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		fs.Usage()
+		return errUsage
+	}
+
+	path, err := yamled.ParsePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	value, err := parseValue(fs.Arg(1), valueType)
+	if err != nil {
+		return err
+	}
+
+	s, err := loadStream(optionalFile(fs.Args(), 2), stdin)
+	if err != nil {
+		return err
+	}
+
+	docs, err := s.selected(flags)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := setValue(doc, path, value); err != nil {
+			return err
+		}
+	}
+
+	return s.write(flags, stdout)
+}
+
+func parseValue(value string, valueType string) (interface{}, error) {
+	switch strings.ToLower(valueType) {
+	case "string", "str":
+		return value, nil
+
+	case "int":
+		return strconv.Atoi(value)
+
+	case "float":
+		return strconv.ParseFloat(value, 64)
+
+	case "bool":
+		return strconv.ParseBool(value)
+
+	case "null":
+		return nil, nil
+
+	case "yaml", "json":
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &node); err != nil {
+			return nil, fmt.Errorf("invalid %s value: %w", valueType, err)
+		}
+
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+
+		return node.Content[0], nil
+
+	default:
+		return nil, fmt.Errorf("unknown value type %q", valueType)
+	}
+}
+
+// setValue replaces the value at the given path, but keeps the
+// comments of the previous value.
+func setValue(doc yamled.Document, path yamled.Path, value interface{}) error {
+	if len(path) == 0 {
+		return doc.Replace(value)
+	}
+
+	old, exists := doc.Get(path...)
+	blank := doc.BlankLinesBefore(path)
+
+	node, err := doc.ReplaceAt(path, value)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if err := doc.SetBlankLinesBefore(path, blank); err != nil {
+			return err
+		}
+
+		if node.HeadComment() == "" {
+			node.SetHeadComment(old.HeadComment())
+		}
+
+		if node.LineComment() == "" {
+			node.SetLineComment(old.LineComment())
+		}
+
+		if node.FootComment() == "" {
+			node.SetFootComment(old.FootComment())
+		}
+	}
+
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// delete
+
+func runDelete(args []string, stdin io.Reader, stdout io.Writer) error {
+	var flags commonFlags
+
+	fs := newFlagSet("delete", "PATH [FILE]")
+	flags.add(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	path, err := yamled.ParsePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if len(path) == 0 {
+		return errors.New("cannot delete the root node")
+	}
+
+	s, err := loadStream(optionalFile(fs.Args(), 1), stdin)
+	if err != nil {
+		return err
+	}
+
+	docs, err := s.selected(flags)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := doc.DeleteKey(path...); err != nil {
+			return err
+		}
+	}
+
+	return s.write(flags, stdout)
+}
+
+/////////////////////////////////////////////////////////////////////
+// merge
+
+func runMerge(args []string, stdin io.Reader, stdout io.Writer) error {
+	var flags commonFlags
+
+	fs := newFlagSet("merge", "FILE OVERLAY")
+	flags.add(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	s, err := loadStream(fs.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+
+	if fs.Arg(1) == "-" {
+		return errors.New("overlay cannot be read from stdin")
+	}
+
+	overlay, err := loadStream(fs.Arg(1), nil)
+	if err != nil {
+		return err
+	}
+
+	if len(overlay.documents) != 1 {
+		return fmt.Errorf("overlay must contain exactly one document, but has %d", len(overlay.documents))
+	}
+
+	overlayRoot, err := overlay.documents[0].RootNode()
+	if err != nil {
+		return err
+	}
+
+	overlayNode, err := overlayRoot.MarshalYAML()
+	if err != nil {
+		return err
+	}
+
+	docs, err := s.selected(flags)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := mergeInto(doc, yamled.Path{}, overlayNode.(*yaml.Node)); err != nil {
+			return err
+		}
+	}
+
+	return s.write(flags, stdout)
+}
+
+// mergeInto deep-merges the overlay into the document: mappings are
+// merged recursively, all other values are replaced.
+func mergeInto(doc yamled.Document, path yamled.Path, overlay *yaml.Node) error {
+	if overlay.Kind == yaml.MappingNode {
+		if existing, ok := getNode(doc, path); ok && existing.Kind() == yaml.MappingNode {
+			for i := 0; i+1 < len(overlay.Content); i += 2 {
+				childPath := append(append(yamled.Path{}, path...), overlay.Content[i].Value)
+
+				if err := mergeInto(doc, childPath, overlay.Content[i+1]); err != nil {
+					return err
+				}
+
+				// carry over comments from the overlay's keys
+				overlayKey := overlay.Content[i]
+				if key, ok := doc.GetKey(childPath...); ok {
+					if key.HeadComment() == "" {
+						key.SetHeadComment(overlayKey.HeadComment)
+					}
+
+					if key.LineComment() == "" {
+						key.SetLineComment(overlayKey.LineComment)
+					}
+
+					if key.FootComment() == "" {
+						key.SetFootComment(overlayKey.FootComment)
+					}
+				}
+			}
+
+			return nil
+		}
+	}
+
+	return setValue(doc, path, overlay)
+}
+
+/////////////////////////////////////////////////////////////////////
+// sort
+
+func runSort(args []string, stdin io.Reader, stdout io.Writer) error {
+	var (
+		flags     commonFlags
+		recursive bool
+		at        string
+	)
+
+	fs := newFlagSet("sort", "[FILE]")
+	flags.add(fs)
+	fs.BoolVar(&recursive, "r", false, "Sort all nested mappings as well.")
+	fs.StringVar(&at, "path", "", "Only sort the mapping at this path.")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	path, err := yamled.ParsePath(at)
+	if err != nil {
+		return err
+	}
+
+	s, err := loadStream(optionalFile(fs.Args(), 0), stdin)
+	if err != nil {
+		return err
+	}
+
+	docs, err := s.selected(flags)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, doc := range docs {
+		sorted, err := sortDocument(doc, path, recursive)
+		if err != nil {
+			return err
+		}
+
+		found = found || sorted
+	}
+
+	if !found {
+		return fmt.Errorf("path %q not found", at)
+	}
+
+	return s.write(flags, stdout)
+}
+
+// sortDocument sorts the keys of the mapping at the given path. A sorted
+// copy replaces the original node, so that the change is made through
+// the Document API like for all other commands. It returns false if the
+// path does not exist in the document.
+func sortDocument(doc yamled.Document, path yamled.Path, recursive bool) (bool, error) {
+	node, ok := getNode(doc, path)
+	if !ok {
+		return false, nil
+	}
+
+	if node.Kind() != yaml.MappingNode {
+		return true, fmt.Errorf("path %q is not a mapping", path.String())
+	}
+
+	sorted, err := node.Clone().MarshalYAML()
+	if err != nil {
+		return true, err
+	}
+
+	sortKeys(sorted.(*yaml.Node), recursive)
+
+	if len(path) == 0 {
+		return true, doc.Replace(sorted)
+	}
+
+	_, err = doc.ReplaceAt(path, sorted)
+
+	return true, err
+}
+
+// sortKeys sorts the keys of a mapping node alphabetically. Comments
+// stay attached to their keys.
+func sortKeys(n *yaml.Node, recursive bool) {
+	if n.Kind == yaml.MappingNode {
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+		}
+
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i][0].Value < pairs[j][0].Value
+		})
+
+		for i, pair := range pairs {
+			n.Content[2*i] = pair[0]
+			n.Content[2*i+1] = pair[1]
+		}
+	}
+
+	if recursive {
+		for _, child := range n.Content {
+			sortKeys(child, recursive)
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// fmt
+
+func runFmt(args []string, stdin io.Reader, stdout io.Writer) error {
+	var flags commonFlags
+
+	fs := newFlagSet("fmt", "[FILE]")
+	flags.add(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	s, err := loadStream(optionalFile(fs.Args(), 0), stdin)
+	if err != nil {
+		return err
+	}
+
+	return s.write(flags, stdout)
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+// yamled is a small command-line tool to edit YAML files without
+// losing their comments.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `yamled edits YAML files while preserving comments.
+
+Usage:
+  yamled get    [flags] PATH [FILE]
+  yamled set    [flags] PATH VALUE [FILE]
+  yamled delete [flags] PATH [FILE]
+  yamled merge  [flags] FILE OVERLAY
+  yamled sort   [flags] [FILE]
+  yamled fmt    [flags] [FILE]
+
+If FILE is omitted or "-", the document is read from stdin. Paths are
+written like "spec.containers[0].image"; keys containing dots can be
+quoted: 'metadata.labels["example.com/name"]'.
+
+Run "yamled COMMAND -h" to see the flags for each command.
+`
+
+type command func(args []string, stdin io.Reader, stdout io.Writer) error
+
+var commands = map[string]command{
+	"get":    runGet,
+	"set":    runSet,
+	"delete": runDelete,
+	"merge":  runMerge,
+	"sort":   runSort,
+	"fmt":    runFmt,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+			os.Exit(0)
+		case errors.Is(err, errUnknownCommand):
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		case errors.Is(err, errUsage):
+			// the command has already printed its usage
+			os.Exit(2)
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+var (
+	errUnknownCommand = errors.New("unknown command")
+	errUsage          = errors.New("invalid usage")
+)
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUnknownCommand
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return errUnknownCommand
+	}
+
+	return cmd(args[1:], stdin, stdout)
+}
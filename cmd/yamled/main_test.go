@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testInput = `
+# config
+name: demo # the name
+spec:
+  image: nginx:1.25 # pinned
+  replicas: 1
+---
+name: second
+`
+
+func runCommand(t *testing.T, input string, args ...string) string {
+	var out strings.Builder
+
+	if err := run(args, strings.NewReader(strings.TrimSpace(input)), &out); err != nil {
+		t.Fatalf("Command %v failed: %v", args, err)
+	}
+
+	return out.String()
+}
+
+func expectOutput(t *testing.T, output string, expected string) {
+	output = strings.TrimSpace(output)
+	expected = strings.TrimSpace(expected)
+
+	if output != expected {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expected, output)
+	}
+}
+
+func TestGet(t *testing.T) {
+	expectOutput(t, runCommand(t, testInput, "get", "spec.image"), "nginx:1.25")
+	expectOutput(t, runCommand(t, testInput, "get", "name"), "demo\nsecond")
+	expectOutput(t, runCommand(t, testInput, "get", "-d", "1", "name"), "second")
+
+	if err := run([]string{"get", "spec.nonexisting"}, strings.NewReader(testInput), &strings.Builder{}); err == nil {
+		t.Fatal("Should have failed to get a non-existing path.")
+	}
+}
+
+func TestSet(t *testing.T) {
+	expectOutput(t, runCommand(t, testInput, "set", "-d", "0", "-type", "int", "spec.replicas", "3"), `
+# config
+name: demo # the name
+spec:
+  image: nginx:1.25 # pinned
+  replicas: 3
+---
+name: second
+`)
+
+	expectOutput(t, runCommand(t, testInput, "set", "-d", "0", "spec.image", "nginx:1.26"), `
+# config
+name: demo # the name
+spec:
+  image: nginx:1.26 # pinned
+  replicas: 1
+---
+name: second
+`)
+
+	expectOutput(t, runCommand(t, testInput, "set", "-d", "1", "-type", "yaml", "labels", "{a: b}"), `
+# config
+name: demo # the name
+spec:
+  image: nginx:1.25 # pinned
+  replicas: 1
+---
+name: second
+labels: {a: b}
+`)
+}
+
+func TestKeepFormatting(t *testing.T) {
+	input := `
+items:
+- a
+
+# b
+- b
+spec:
+    x: 1
+
+    y: 2
+`
+
+	expectOutput(t, runCommand(t, input, "fmt"), input)
+
+	expectOutput(t, runCommand(t, input, "set", "items[1]", "c"), `
+items:
+- a
+
+# b
+- c
+spec:
+    x: 1
+
+    y: 2
+`)
+}
+
+func TestSetInvalidType(t *testing.T) {
+	for _, args := range [][]string{
+		{"set", "-type", "int", "name", "foo"},
+		{"set", "-type", "unknown", "name", "foo"},
+	} {
+		if err := run(args, strings.NewReader(testInput), &strings.Builder{}); err == nil {
+			t.Errorf("Command %v should have failed.", args)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	expectOutput(t, runCommand(t, testInput, "delete", "spec.image"), `
+# config
+name: demo # the name
+spec:
+  replicas: 1
+---
+name: second
+`)
+}
+
+func TestSortAndFmt(t *testing.T) {
+	input := `
+b: {d: 1, c: 2}
+a:     [1, 2]
+`
+
+	expectOutput(t, runCommand(t, input, "sort", "-r"), `
+a: [1, 2]
+b: {c: 2, d: 1}
+`)
+
+	expectOutput(t, runCommand(t, input, "fmt", "-indent", "4"), `
+b: {d: 1, c: 2}
+a: [1, 2]
+`)
+}
+
+func TestSortKeepsComments(t *testing.T) {
+	input := `
+# about c
+c: 3
+b:
+  z: 1
+  # about y
+  y: 2
+a: [3, 2, 1]
+`
+
+	expectOutput(t, runCommand(t, input, "sort", "-path", "b"), `
+# about c
+c: 3
+b:
+  # about y
+  y: 2
+  z: 1
+a: [3, 2, 1]
+`)
+
+	expectOutput(t, runCommand(t, input, "sort", "-r"), `
+a: [3, 2, 1]
+b:
+  # about y
+  y: 2
+  z: 1
+# about c
+c: 3
+`)
+}
+
+func TestSortInvalidPath(t *testing.T) {
+	for _, args := range [][]string{
+		{"sort", "-path", "spec.nonexisting"},
+		{"sort", "-path", "name"},
+	} {
+		if err := run(args, strings.NewReader(testInput), &strings.Builder{}); err == nil {
+			t.Errorf("Command %v should have failed.", args)
+		}
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	expectOutput(t, runCommand(t, "", "fmt"), "")
+	expectOutput(t, runCommand(t, "", "set", "name", "demo"), "")
+}
+
+func TestSkipEmptyDocuments(t *testing.T) {
+	expectOutput(t, runCommand(t, "name: a\n---\n---\nname: b", "set", "name", "c"), `
+name: c
+---
+
+---
+name: c
+`)
+}
+
+func TestMergeInPlace(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	overlay := filepath.Join(dir, "overlay.yaml")
+
+	if err := os.WriteFile(base, []byte(strings.TrimSpace(testInput)), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := os.WriteFile(overlay, []byte("spec:\n  replicas: 2\n  # new field\n  port: 80\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	expectOutput(t, runCommand(t, "", "merge", "-i", "-d", "0", base, overlay), "")
+
+	content, err := os.ReadFile(base)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	expectOutput(t, string(content), `
+# config
+name: demo # the name
+spec:
+  image: nginx:1.25 # pinned
+  replicas: 2
+  # new field
+  port: 80
+---
+name: second
+`)
+
+	info, err := os.Stat(base)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected file mode to be preserved, but is %v.", info.Mode())
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.xrstf.de/yamled"
+	"gopkg.in/yaml.v3"
+)
+
+// commonFlags are shared by all commands.
+type commonFlags struct {
+	inPlace  bool
+	indent   int
+	document int
+}
+
+func (f *commonFlags) add(fs *flag.FlagSet) {
+	fs.BoolVar(&f.inPlace, "i", false, "Edit the file in-place instead of printing to stdout.")
+	fs.IntVar(&f.indent, "indent", 0, "Number of spaces to use for indentation (default: keep the detected indentation).")
+	fs.IntVar(&f.document, "d", -1, "Only process the n-th document (0-based) in a multi-document file.")
+}
+
+// stream is a sequence of YAML documents, as read from a file.
+type stream struct {
+	filename  string
+	documents []yamled.Document
+}
+
+func loadStream(filename string, stdin io.Reader) (*stream, error) {
+	s := &stream{
+		filename: filename,
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	if filename != "" && filename != "-" {
+		data, err = os.ReadFile(filename)
+	} else {
+		data, err = io.ReadAll(stdin)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.documents, err = yamled.LoadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// selected returns the documents chosen by the -d flag. Without the
+// flag, empty documents (like a lone "---") are skipped.
+func (s *stream) selected(flags commonFlags) ([]yamled.Document, error) {
+	if flags.document < 0 {
+		var docs []yamled.Document
+		for _, doc := range s.documents {
+			if !isEmpty(doc) {
+				docs = append(docs, doc)
+			}
+		}
+
+		return docs, nil
+	}
+
+	if flags.document >= len(s.documents) {
+		return nil, fmt.Errorf("document %d does not exist, file contains only %d documents", flags.document, len(s.documents))
+	}
+
+	return s.documents[flags.document : flags.document+1], nil
+}
+
+// isEmpty returns true if the document has no content at all.
+func isEmpty(doc yamled.Document) bool {
+	root, err := doc.RootNode()
+	if err != nil {
+		return true
+	}
+
+	raw, err := root.MarshalYAML()
+	if err != nil {
+		return false
+	}
+
+	n := raw.(*yaml.Node)
+
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null" && n.Value == ""
+}
+
+// bytes encodes all documents using their detected format, so that
+// blank lines and the sequence style are kept. If indent is not 0, it
+// overrides the detected indentation.
+func (s *stream) bytes(indent int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for i, doc := range s.documents {
+		lineEnding := doc.Format().LineEnding
+		if lineEnding == "" {
+			lineEnding = "\n"
+		}
+
+		if i > 0 {
+			buf.WriteString("---" + lineEnding)
+		}
+
+		encoded, err := doc.Bytes(indent)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(encoded)
+
+		// only the last document may end without a line break
+		if i < len(s.documents)-1 && !bytes.HasSuffix(encoded, []byte("\n")) {
+			buf.WriteString(lineEnding)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// write outputs the stream, either to stdout or back into
+// the file it was read from.
+func (s *stream) write(flags commonFlags, stdout io.Writer) error {
+	encoded, err := s.bytes(flags.indent)
+	if err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+
+	if !flags.inPlace {
+		_, err := stdout.Write(encoded)
+		return err
+	}
+
+	if s.filename == "" || s.filename == "-" {
+		return errors.New("cannot edit stdin in-place")
+	}
+
+	return yamled.WriteFile(s.filename, encoded)
+}
@@ -0,0 +1,247 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CommentPosition selects one of the three comments yaml.v3 keeps for
+// each node.
+type CommentPosition int
+
+const (
+	// CommentHead is the comment in the lines before a node.
+	CommentHead CommentPosition = iota
+	// CommentLine is the comment at the end of a node's line.
+	CommentLine
+	// CommentFoot is the comment in the lines after a node.
+	CommentFoot
+)
+
+// CommentMatch is a comment found by FindComments().
+type CommentMatch struct {
+	// Path is the path to the node with the comment.
+	Path Path
+	// Node is the node with the comment; if OnKey is true, the
+	// comment is on its key.
+	Node     Node
+	OnKey    bool
+	Position CommentPosition
+	// Lines is the comment as plain lines.
+	Lines []string
+}
+
+// commentLines turns a raw comment like "# foo\n\n# bar" into plain
+// lines like ["foo", "", "bar"]. Blank lines before the comment are not
+// part of it.
+func commentLines(comment string) []string {
+	comment = strings.TrimLeft(comment, "\n")
+	if comment == "" {
+		return nil
+	}
+
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "#")
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+
+	return lines
+}
+
+// formatComment turns plain lines into a raw comment. Empty lines are
+// kept as blank lines between comment paragraphs.
+func formatComment(lines []string) string {
+	formatted := make([]string, len(lines))
+	for i, line := range lines {
+		if line != "" {
+			formatted[i] = "# " + line
+		}
+	}
+
+	return strings.Join(formatted, "\n")
+}
+
+// replaceComment formats the lines as a comment that replaces the given
+// one, keeping the blank lines before it.
+func replaceComment(comment string, lines []string) string {
+	return withBlankLines(formatComment(lines), blankLines(comment))
+}
+
+func appendCommentLine(comment string, line string) string {
+	return replaceComment(comment, append(commentLines(comment), line))
+}
+
+// stripComments removes all comments from the node and its children,
+// but keeps the blank lines between them.
+func stripComments(n *yaml.Node) {
+	n.HeadComment = withBlankLines("", blankLines(n.HeadComment))
+	n.LineComment = ""
+	n.FootComment = ""
+
+	for _, child := range n.Content {
+		stripComments(child)
+	}
+}
+
+func findComments(n *node, key *yaml.Node, path Path, pattern *regexp.Regexp, found func(CommentMatch)) {
+	check := func(raw *yaml.Node, onKey bool) {
+		for _, pos := range []CommentPosition{CommentHead, CommentLine, CommentFoot} {
+			lines := commentLines(*commentTarget(raw, pos))
+			if len(lines) > 0 && pattern.MatchString(strings.Join(lines, "\n")) {
+				found(CommentMatch{
+					Path:     copyPath(path),
+					Node:     n,
+					OnKey:    onKey,
+					Position: pos,
+					Lines:    lines,
+				})
+			}
+		}
+	}
+
+	if key != nil {
+		check(key, true)
+	}
+
+	check(n.node, false)
+
+	switch n.node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.node.Content); i += 2 {
+			key := n.node.Content[i]
+			findComments(n.child(n.node.Content[i+1]), key, append(copyPath(path), keyStep(key)), pattern, found)
+		}
+
+	case yaml.SequenceNode:
+		for i, item := range n.node.Content {
+			findComments(n.child(item), nil, append(copyPath(path), i), pattern, found)
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// Node
+
+// CommentLines returns the comment as plain lines without the leading
+// "#". Blank lines between comment paragraphs are returned as empty
+// strings.
+func (n *node) CommentLines(pos CommentPosition) []string {
+	return commentLines(*commentTarget(n.node, pos))
+}
+
+// SetCommentLines sets the comment from plain lines, adding the "#"
+// markers. Empty lines become blank lines between paragraphs.
+func (n *node) SetCommentLines(pos CommentPosition, lines ...string) Node {
+	n.tree.setComment(n.node, pos, replaceComment(*commentTarget(n.node, pos), lines))
+	return n
+}
+
+// AppendCommentLine adds a plain line to the end of the comment.
+func (n *node) AppendCommentLine(pos CommentPosition, line string) Node {
+	n.tree.setComment(n.node, pos, appendCommentLine(*commentTarget(n.node, pos), line))
+	return n
+}
+
+// StripComments removes all comments from this node and all of its
+// children, including mapping keys.
+func (n *node) StripComments() Node {
+	n.tree.stripComments(n.node)
+	return n
+}
+
+// FindComments returns all comments on this node and its children
+// (including mapping keys) that match the pattern, in document order.
+// The pattern is matched against the plain lines, joined by newlines.
+func (n *node) FindComments(pattern *regexp.Regexp) []CommentMatch {
+	var matches []CommentMatch
+	findComments(n, nil, Path{}, pattern, func(m CommentMatch) {
+		matches = append(matches, m)
+	})
+
+	return matches
+}
+
+/////////////////////////////////////////////////////////////////////
+// KeyNode
+
+func (n *keyNode) CommentLines(pos CommentPosition) []string {
+	return commentLines(*commentTarget(n.node, pos))
+}
+
+func (n *keyNode) SetCommentLines(pos CommentPosition, lines ...string) KeyNode {
+	n.tree.setComment(n.node, pos, replaceComment(*commentTarget(n.node, pos), lines))
+	return n
+}
+
+func (n *keyNode) AppendCommentLine(pos CommentPosition, line string) KeyNode {
+	n.tree.setComment(n.node, pos, appendCommentLine(*commentTarget(n.node, pos), line))
+	return n
+}
+
+// StripComments removes all comments from the key; the comments on its
+// value are kept.
+func (n *keyNode) StripComments() KeyNode {
+	n.tree.stripComments(n.node)
+	return n
+}
+
+/////////////////////////////////////////////////////////////////////
+// Document
+
+// CommentLines returns the document's comment as plain lines.
+func (d *document) CommentLines(pos CommentPosition) []string {
+	return commentLines(*commentTarget(d.node, pos))
+}
+
+func (d *document) SetCommentLines(pos CommentPosition, lines ...string) Document {
+	d.setComment(pos, replaceComment(*commentTarget(d.node, pos), lines))
+	return d
+}
+
+func (d *document) AppendCommentLine(pos CommentPosition, line string) Document {
+	d.setComment(pos, appendCommentLine(*commentTarget(d.node, pos), line))
+	return d
+}
+
+// StripComments removes all comments from the document.
+func (d *document) StripComments() Document {
+	if root, err := d.RootNode(); err == nil {
+		root.StripComments()
+	}
+
+	for _, pos := range []CommentPosition{CommentHead, CommentLine, CommentFoot} {
+		d.setComment(pos, "")
+	}
+
+	return d
+}
+
+// FindComments returns all comments in the document that match the
+// pattern, in document order. Comments on the document itself have an
+// empty path and no node.
+func (d *document) FindComments(pattern *regexp.Regexp) []CommentMatch {
+	var matches []CommentMatch
+
+	for _, pos := range []CommentPosition{CommentHead, CommentLine} {
+		if lines := d.CommentLines(pos); len(lines) > 0 && pattern.MatchString(strings.Join(lines, "\n")) {
+			matches = append(matches, CommentMatch{Path: Path{}, Position: pos, Lines: lines})
+		}
+	}
+
+	if root, err := d.RootNode(); err == nil {
+		matches = append(matches, root.FindComments(pattern)...)
+	}
+
+	if lines := d.CommentLines(CommentFoot); len(lines) > 0 && pattern.MatchString(strings.Join(lines, "\n")) {
+		matches = append(matches, CommentMatch{Path: Path{}, Position: CommentFoot, Lines: lines})
+	}
+
+	return matches
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCommentLines(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+name: test
+
+# Section
+
+# about foo
+foo: bar # inline
+list:
+  - a
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	key, ok := doc.GetKey("foo")
+	if !ok {
+		t.Fatal("Expected to find key.")
+	}
+
+	if lines := key.CommentLines(CommentHead); strings.Join(lines, "|") != "Section||about foo" {
+		t.Fatalf("Unexpected head comment lines %q.", lines)
+	}
+
+	if lines := doc.MustGet("foo").CommentLines(CommentLine); len(lines) != 1 || lines[0] != "inline" {
+		t.Fatalf("Unexpected line comment lines %q.", lines)
+	}
+
+	key.SetCommentLines(CommentHead, "about foo", "", "second paragraph")
+	doc.MustGet("list", 0).AppendCommentLine(CommentHead, "first item").AppendCommentLine(CommentHead, "really")
+	doc.AppendCommentLine(CommentFoot, "the end")
+
+	expectYAML(t, node, `
+name: test
+# about foo
+
+# second paragraph
+foo: bar # inline
+list:
+  # first item
+  # really
+  - a
+
+# the end
+`)
+}
+
+func TestStripComments(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+# head
+
+# about foo
+foo: bar # inline
+nested:
+  # about a
+  a: 1 # one
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.MustGet("nested").StripComments()
+
+	expectYAML(t, node, `
+# head
+
+# about foo
+foo: bar # inline
+nested:
+  a: 1
+`)
+
+	doc.EnableHistory()
+	doc.StripComments()
+
+	expectYAML(t, node, `
+foo: bar
+nested:
+  a: 1
+`)
+
+	for doc.CanUndo() {
+		if err := doc.Undo(); err != nil {
+			t.Fatalf("Failed to undo: %v", err)
+		}
+	}
+
+	expectYAML(t, node, `
+# head
+
+# about foo
+foo: bar # inline
+nested:
+  a: 1
+`)
+}
+
+func TestFindComments(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(`
+# TODO: document this file
+
+# TODO: rename
+foo: bar
+list:
+  - a # todo: lowercase does not match
+  - b # TODO: remove
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	matches := doc.FindComments(regexp.MustCompile(`^TODO:`))
+
+	var found []string
+	for _, m := range matches {
+		found = append(found, m.Path.String()+" "+strings.Join(m.Lines, "|"))
+	}
+
+	expected := []string{
+		" TODO: document this file",
+		"foo TODO: rename",
+		"list.[1] TODO: remove",
+	}
+
+	if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected matches\n%s\n\nbut got\n\n%s", strings.Join(expected, "\n"), strings.Join(found, "\n"))
+	}
+
+	if !matches[1].OnKey || matches[1].Position != CommentHead {
+		t.Fatalf("Expected second match to be the key's head comment, but got %+v.", matches[1])
+	}
+}
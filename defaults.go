@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultsOptions configures how defaults are applied.
+type DefaultsOptions struct {
+	// Comment is added as a line comment to every inserted value, for
+	// example "default", so that users can see what has been implied.
+	// If empty, no comments are added.
+	Comment string
+}
+
+// ApplyDefaults inserts the default values from the schema for all
+// properties that are missing in the given node, recursing into objects
+// and arrays. Only properties whose schema has an explicit default are
+// inserted. The paths (relative to n) of all inserted values are returned.
+func (s *Schema) ApplyDefaults(n Node, opts DefaultsOptions) ([]Path, error) {
+	var inserted []Path
+
+	if err := s.applyDefaults(n, Path{}, opts, &inserted); err != nil {
+		return inserted, err
+	}
+
+	return inserted, nil
+}
+
+// ApplyDocumentDefaults applies the defaults to the document's root node.
+// The defaults are applied through Document.Edit(), so they are part of
+// the document's history and transactions and cannot be inserted below
+// protected paths.
+func (s *Schema) ApplyDocumentDefaults(d Document, opts DefaultsOptions) ([]Path, error) {
+	root, err := d.RootNode()
+	if err != nil {
+		return nil, err
+	}
+
+	var inserted []Path
+
+	err = d.Edit(nil, func(*yaml.Node) error {
+		inserted, err = s.ApplyDefaults(root, opts)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *Schema) applyDefaults(root Node, path Path, opts DefaultsOptions, inserted *[]Path) error {
+	if s.always != nil {
+		return nil
+	}
+
+	if s.ref != "" {
+		referenced, err := s.root.resolveRef(s.ref)
+		if err != nil {
+			return err
+		}
+
+		if err := referenced.applyDefaults(root, path, opts, inserted); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.applyDefaults(root, path, opts, inserted); err != nil {
+			return err
+		}
+	}
+
+	current := root
+	if len(path) > 0 {
+		var ok bool
+		if current, ok = root.Get(path...); !ok {
+			return nil
+		}
+	}
+
+	switch current.Kind() {
+	case yaml.MappingNode:
+		for _, name := range s.propertyOrder {
+			propertyPath := append(append(Path{}, path...), name)
+			propertySchema := s.properties[name]
+
+			if _, exists := root.Get(propertyPath...); !exists {
+				if propertySchema.defaultValue == nil {
+					continue
+				}
+
+				if err := insertDefault(root, propertyPath, propertySchema.defaultValue, opts); err != nil {
+					return fmt.Errorf("%s: %w", propertyPath, err)
+				}
+
+				*inserted = append(*inserted, propertyPath)
+			}
+
+			if err := propertySchema.applyDefaults(root, propertyPath, opts, inserted); err != nil {
+				return err
+			}
+		}
+
+	case yaml.SequenceNode:
+		if s.items == nil && len(s.prefixItems) == 0 {
+			return nil
+		}
+
+		for i := range current.ToSlice() {
+			itemSchema := s.items
+			if i < len(s.prefixItems) {
+				itemSchema = s.prefixItems[i]
+			}
+
+			if itemSchema == nil {
+				continue
+			}
+
+			if err := itemSchema.applyDefaults(root, append(append(Path{}, path...), i), opts, inserted); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func insertDefault(root Node, path Path, value *yaml.Node, opts DefaultsOptions) error {
+	// defaults from JSON schemas are always in flow style, but
+	// block style looks much more natural in YAML documents
+	value = blockStyle(value)
+
+	// comments cannot be rendered inside flow collections
+	if parent, ok := root.Get(path.Parent()...); ok && len(path) > 1 && opts.Comment != "" && parent.Style()&yaml.FlowStyle != 0 {
+		if err := parent.SetStyle(parent.Style() &^ yaml.FlowStyle); err != nil {
+			return err
+		}
+
+		// for block collections, line comments must be placed on the key
+		if comment := parent.LineComment(); comment != "" {
+			if key, ok := root.GetKey(path.Parent()...); ok && key.LineComment() == "" {
+				key.SetLineComment(comment)
+				parent.SetLineComment("")
+			}
+		}
+	}
+
+	inserted, err := root.SetAt(path, value)
+	if err != nil {
+		return err
+	}
+
+	if opts.Comment == "" {
+		return nil
+	}
+
+	// yaml.v3 only renders line comments on the key for block collections
+	if inserted.Kind() == yaml.ScalarNode || inserted.Style()&yaml.FlowStyle != 0 {
+		inserted.SetLineComment(opts.Comment)
+	} else if key, ok := root.GetKey(path...); ok {
+		key.SetLineComment(opts.Comment)
+	}
+
+	return nil
+}
+
+// blockStyle returns a copy of the node with all collections
+// being in block style.
+func blockStyle(n *yaml.Node) *yaml.Node {
+	copied := *n
+
+	if n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode {
+		copied.Style &^= yaml.FlowStyle
+		copied.Content = make([]*yaml.Node, len(n.Content))
+
+		for i, child := range n.Content {
+			copied.Content[i] = blockStyle(child)
+		}
+	}
+
+	return &copied
+}
+
+/////////////////////////////////////////////////////////////////////
+// struct schemas
+
+// SchemaFromStruct creates a schema from a Go struct, using the same
+// field names as yaml.v3 would. Default values are given in the
+// `default` tag and are parsed as YAML, like in
+//
+//	Replicas int      `yaml:"replicas" default:"3"`
+//	Ports    []string `yaml:"ports" default:"[80, 443]"`
+//
+// The resulting schema also describes the types of all fields.
+func SchemaFromStruct(v interface{}) (*Schema, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, errors.New("value cannot be nil")
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, but got %v", t)
+	}
+
+	root := &schemaRoot{
+		refs: map[string]*Schema{},
+	}
+
+	return schemaFromType(root, t, map[reflect.Type]bool{})
+}
+
+func schemaFromType(root *schemaRoot, t reflect.Type, inProgress map[reflect.Type]bool) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	s := &Schema{root: root}
+
+	// types implementing their own (un)marshalling cannot be described
+	if t.Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) || reflect.PointerTo(t).Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) {
+		return s, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s.types = []string{"boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.types = []string{"integer"}
+
+	case reflect.Float32, reflect.Float64:
+		s.types = []string{"number"}
+
+	case reflect.String:
+		s.types = []string{"string"}
+
+	case reflect.Slice, reflect.Array:
+		items, err := schemaFromType(root, t.Elem(), inProgress)
+		if err != nil {
+			return nil, err
+		}
+
+		s.types = []string{"array"}
+		s.items = items
+
+	case reflect.Map:
+		values, err := schemaFromType(root, t.Elem(), inProgress)
+		if err != nil {
+			return nil, err
+		}
+
+		s.types = []string{"object"}
+		s.additionalProperties = values
+
+	case reflect.Struct:
+		// recursive types are only described up to the first repetition
+		if inProgress[t] {
+			return s, nil
+		}
+
+		inProgress[t] = true
+		defer delete(inProgress, t)
+
+		s.types = []string{"object"}
+		s.properties = map[string]*Schema{}
+
+		if err := addStructFields(root, s, t, inProgress); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func addStructFields(root *schemaRoot, s *Schema, t reflect.Type, inProgress map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, inline, skip := yamlFieldName(field)
+		if skip {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if inline && fieldType.Kind() == reflect.Struct {
+			if err := addStructFields(root, s, fieldType, inProgress); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		fieldSchema, err := schemaFromType(root, field.Type, inProgress)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.Name, err)
+		}
+
+		if def, ok := field.Tag.Lookup("default"); ok {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(def), &node); err != nil {
+				return fmt.Errorf("%s: invalid default value: %w", field.Name, err)
+			}
+
+			if len(node.Content) > 0 {
+				fieldSchema.defaultValue = node.Content[0]
+			} else {
+				fieldSchema.defaultValue = stringNode("")
+			}
+		}
+
+		if _, exists := s.properties[name]; !exists {
+			s.propertyOrder = append(s.propertyOrder, name)
+		}
+
+		s.properties[name] = fieldSchema
+	}
+
+	return nil
+}
+
+// yamlFieldName mimics yaml.v3's handling of struct tags.
+func yamlFieldName(field reflect.StructField) (name string, inline bool, skip bool) {
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+
+	for _, flag := range parts[1:] {
+		if flag == "inline" {
+			inline = true
+		}
+	}
+
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	return name, inline, false
+}
@@ -0,0 +1,233 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplySchemaDefaults(t *testing.T) {
+	schema, err := ParseSchema([]byte(`
+type: object
+properties:
+  replicas:
+    type: integer
+    default: 1
+  image:
+    type: string
+  resources:
+    $ref: "#/$defs/resources"
+  ports:
+    type: array
+    items:
+      type: object
+      properties:
+        protocol:
+          default: TCP
+$defs:
+  resources:
+    type: object
+    default: {}
+    properties:
+      cpu:
+        default: 100m
+      memory:
+        default: 128Mi
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+# my app
+image: nginx
+resources:
+  cpu: 2 # lots
+ports:
+  - port: 80
+  - port: 53
+    protocol: UDP
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	inserted, err := schema.ApplyDocumentDefaults(doc, DefaultsOptions{Comment: "default"})
+	if err != nil {
+		t.Fatalf("Failed to apply defaults: %v", err)
+	}
+
+	if len(inserted) != 3 {
+		t.Fatalf("Expected 3 inserted values, but got %v.", inserted)
+	}
+
+	expectYAML(t, node, `
+# my app
+image: nginx
+resources:
+  cpu: 2 # lots
+  memory: 128Mi # default
+ports:
+  - port: 80
+    protocol: TCP # default
+  - port: 53
+    protocol: UDP
+replicas: 1 # default
+`)
+}
+
+func TestApplyDefaultsToEmptyObject(t *testing.T) {
+	schema, err := ParseSchema([]byte(`
+properties:
+  resources:
+    default: {}
+    properties:
+      limits:
+        default:
+          cpu: 1
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	node, doc, err := yamlLoad(`name: test`)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if _, err := schema.ApplyDocumentDefaults(doc, DefaultsOptions{Comment: "default"}); err != nil {
+		t.Fatalf("Failed to apply defaults: %v", err)
+	}
+
+	expectYAML(t, node, `
+name: test
+resources: # default
+  limits: # default
+    cpu: 1
+`)
+}
+
+func TestApplyDocumentDefaultsHistory(t *testing.T) {
+	schema, err := ParseSchema([]byte(`
+properties:
+  replicas:
+    default: 1
+  metadata:
+    properties:
+      namespace:
+        default: default
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	input := strings.TrimSpace(`
+name: test
+metadata:
+  labels: {}
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	if err := doc.Protect("metadata"); err != nil {
+		t.Fatalf("Failed to protect: %v", err)
+	}
+
+	_, err = schema.ApplyDocumentDefaults(doc, DefaultsOptions{Comment: "default"})
+	expectReadOnlyError(t, err, "metadata")
+	expectYAML(t, node, input)
+
+	doc.Unprotect()
+
+	if _, err := schema.ApplyDocumentDefaults(doc, DefaultsOptions{Comment: "default"}); err != nil {
+		t.Fatalf("Failed to apply defaults: %v", err)
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo defaults: %v", err)
+	}
+
+	expectYAML(t, node, input)
+}
+
+type testAppConfig struct {
+	Name     string            `yaml:"name"`
+	Replicas int               `yaml:"replicas" default:"3"`
+	Debug    bool              `yaml:"debug,omitempty" default:"false"`
+	Ports    []int             `yaml:"ports" default:"[80, 443]"`
+	Labels   map[string]string `yaml:"labels"`
+	Database testDatabase      `yaml:"database"`
+	Ignored  string            `yaml:"-" default:"nope"`
+
+	testEmbedded `yaml:",inline"`
+}
+
+type testDatabase struct {
+	Host string `default:"localhost"`
+	Port *int   `yaml:"port" default:"5432"`
+}
+
+type testEmbedded struct {
+	Timeout string `yaml:"timeout" default:"30s"`
+}
+
+func TestApplyStructDefaults(t *testing.T) {
+	schema, err := SchemaFromStruct(&testAppConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+name: app
+database:
+  port: 3306
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if _, err := schema.ApplyDocumentDefaults(doc, DefaultsOptions{}); err != nil {
+		t.Fatalf("Failed to apply defaults: %v", err)
+	}
+
+	expectYAML(t, node, `
+name: app
+database:
+  port: 3306
+  host: localhost
+replicas: 3
+debug: false
+ports:
+  - 80
+  - 443
+timeout: 30s
+`)
+
+	// the generated schema can also be used for validation
+	doc.MustGet("replicas").Set("many")
+
+	if violations := schema.ValidateDocument(doc); len(violations) != 1 {
+		t.Fatalf("Expected 1 violation, but got %v.", violations)
+	}
+}
+
+func TestSchemaFromInvalidStruct(t *testing.T) {
+	type invalid struct {
+		Value int `default:"[1"`
+	}
+
+	if _, err := SchemaFromStruct(invalid{}); err == nil {
+		t.Error("Should not have been able to create a schema with an invalid default.")
+	}
+
+	if _, err := SchemaFromStruct("foo"); err == nil {
+		t.Error("Should not have been able to create a schema from a string.")
+	}
+}
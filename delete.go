@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DeleteOptions control what happens to the comments around an entry
+// that is removed using DeleteAt().
+type DeleteOptions struct {
+	// KeepComments keeps comments that belong to the surrounding
+	// section instead of the removed entry, by moving them to its
+	// neighbours. These are all but the last paragraph of the entry's
+	// head comment (paragraphs are separated by blank lines) and its
+	// foot comment. The last paragraph is considered to document the
+	// entry itself and is removed with it.
+	KeepComments bool
+	// Tombstone leaves a comment like "# removed: key" where the entry
+	// used to be.
+	Tombstone bool
+}
+
+// DeleteAt removes the mapping entry or sequence item at the given path
+// and handles the surrounding comments according to the options. Like
+// DeleteKey(), it is not an error if the path does not exist.
+func (n *node) DeleteAt(path Path, opts DeleteOptions) error {
+	// as comments of the neighbouring entries can change, the change
+	// is recorded as a replacement of the parent
+	if opts == (DeleteOptions{}) {
+		return n.tree.changeAt(n.node, path, changeRemoving, func() error {
+			return n.deleteAt(path, opts)
+		})
+	}
+
+	return n.tree.changeAt(n.node, path.Parent(), changeInPlace, func() error {
+		return n.deleteAt(path, opts)
+	})
+}
+
+func (n *node) deleteAt(path Path, opts DeleteOptions) error {
+	parent, index, err := n.entry(path)
+	if err != nil || index < 0 {
+		return err
+	}
+
+	container := parent.node
+
+	removed := entryComments(container, index, opts)
+
+	parent.tree.keyIndex().invalidate(container)
+	parent.tree.keyIndex().removed(childAt(container, index))
+	if err := removeChild(container, index); err != nil {
+		return err
+	}
+
+	attachComments(container, index, removed)
+
+	return nil
+}
+
+// entry returns the collection containing the entry at the given path
+// and the entry's index in it, or -1 if the path does not exist.
+func (n *node) entry(path Path) (*node, int, error) {
+	if len(path) == 0 {
+		return nil, -1, errors.New("path cannot be empty")
+	}
+
+	if err := path.Validate(); err != nil {
+		return nil, -1, err
+	}
+
+	parent := n
+	if len(path) > 1 {
+		child, found, _ := n.get(path.Parent()...)
+		if !found {
+			return nil, -1, nil
+		}
+
+		parent = child.(*node)
+	}
+
+	switch step := path.End(); parent.node.Kind {
+	case yaml.MappingNode:
+		if !isKeyStep(step) {
+			return nil, -1, nil
+		}
+
+		index, err := parent.tree.findKey(parent.node, step, true)
+		return parent, index, err
+
+	case yaml.SequenceNode:
+		return parent, childIndex(parent.node, step), nil
+
+	default:
+		return nil, -1, nil
+	}
+}
+
+// removedComments are the comments that remain after an entry has been
+// removed.
+type removedComments struct {
+	// section comes before the entry.
+	section string
+	// tombstone replaces the entry.
+	tombstone string
+	// foot comes after the entry.
+	foot string
+	// blank is the number of blank lines before the entry.
+	blank int
+}
+
+func entryComments(container *yaml.Node, index int, opts DeleteOptions) removedComments {
+	var result removedComments
+
+	entry := container.Content[index]
+
+	if opts.KeepComments {
+		paragraphs := strings.Split(strings.TrimLeft(entry.HeadComment, "\n"), "\n\n")
+		result.section = joinParagraphs(paragraphs[:len(paragraphs)-1]...)
+
+		result.blank = blankLines(entry.HeadComment)
+
+		result.foot = entry.FootComment
+		if container.Kind == yaml.MappingNode {
+			result.foot = joinParagraphs(result.foot, container.Content[index+1].FootComment)
+		}
+	}
+
+	if opts.Tombstone {
+		result.tombstone = "# removed: " + entryName(container, index)
+	}
+
+	return result
+}
+
+// entryName describes an entry for tombstone comments.
+func entryName(container *yaml.Node, index int) string {
+	entry := container.Content[index]
+
+	switch {
+	case entry.Kind == yaml.ScalarNode:
+		return entry.Value
+	case container.Kind == yaml.MappingNode:
+		return KeyStep{node: entry}.String()
+	default:
+		return fmt.Sprintf("item %d", index)
+	}
+}
+
+// attachComments moves the remaining comments of the entry that was
+// removed from the given position to its neighbours.
+func attachComments(container *yaml.Node, index int, comments removedComments) {
+	size := 1
+	if container.Kind == yaml.MappingNode {
+		size = 2
+	}
+
+	var previous, next *yaml.Node
+	if index > 0 {
+		previous = container.Content[index-size]
+	}
+	if index < len(container.Content) {
+		next = container.Content[index]
+	}
+
+	// keep the entries separated like the removed one was
+	if next != nil && comments.blank > blankLines(next.HeadComment) {
+		next.HeadComment = withBlankLines(next.HeadComment, comments.blank)
+	}
+
+	switch {
+	case next != nil && previous != nil:
+		// the foot comment ended the section, which now ends earlier
+		next.HeadComment = prependComment(next.HeadComment, comments.section, comments.tombstone)
+		previous.FootComment = joinParagraphs(previous.FootComment, comments.foot)
+
+	case next != nil:
+		next.HeadComment = prependComment(next.HeadComment, comments.section, comments.tombstone, comments.foot)
+
+	case previous != nil:
+		previous.FootComment = joinParagraphs(previous.FootComment, comments.section, comments.tombstone, comments.foot)
+
+	default:
+		// an empty collection can only have a line comment, so section
+		// comments are lost
+		if container.LineComment == "" {
+			container.LineComment = comments.tombstone
+		}
+	}
+}
+
+// DeleteAt removes the entry at the given path like Node.DeleteAt().
+// As comments of the neighbouring entries can change, the change is
+// recorded as a replacement of the parent.
+func (d *document) DeleteAt(path Path, opts DeleteOptions) error {
+	n, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	if opts == (DeleteOptions{}) {
+		return d.mutateDelete(path, func() error {
+			return n.DeleteAt(path, opts)
+		})
+	}
+
+	return d.mutate(path.Parent(), func() error {
+		return n.DeleteAt(path, opts)
+	})
+}
+
+// joinParagraphs joins all non-empty comments, separated by blank lines.
+func joinParagraphs(comments ...string) string {
+	var paragraphs []string
+	for _, comment := range comments {
+		if comment != "" {
+			paragraphs = append(paragraphs, comment)
+		}
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// prependComment puts the comments in front of a head comment, separated
+// by blank lines, but after the blank lines before the head comment.
+func prependComment(head string, comments ...string) string {
+	joined := joinParagraphs(append(comments, strings.TrimLeft(head, "\n"))...)
+	return withBlankLines(joined, blankLines(head))
+}
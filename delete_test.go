@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+const sectionsInput = `
+name: web
+server:
+  # Networking
+
+  # the port
+  port: 80
+  host: localhost
+  # end of networking
+list:
+  - a
+  - b
+`
+
+func TestDeleteAt(t *testing.T) {
+	testcases := []struct {
+		name     string
+		path     Path
+		opts     DeleteOptions
+		expected string
+	}{
+		{
+			name: "plain delete loses section comments",
+			path: Path{"server", "port"},
+			expected: `
+name: web
+server:
+  host: localhost
+  # end of networking
+list:
+  - a
+  - b
+`,
+		},
+		{
+			name: "section comment moves to the next key",
+			path: Path{"server", "port"},
+			opts: DeleteOptions{KeepComments: true},
+			expected: `
+name: web
+server:
+  # Networking
+  host: localhost
+  # end of networking
+list:
+  - a
+  - b
+`,
+		},
+		{
+			name: "foot comment moves to the previous key",
+			path: Path{"server", "host"},
+			opts: DeleteOptions{KeepComments: true},
+			expected: `
+name: web
+server:
+  # Networking
+
+  # the port
+  port: 80
+  # end of networking
+list:
+  - a
+  - b
+`,
+		},
+		{
+			name: "tombstone",
+			path: Path{"server", "port"},
+			opts: DeleteOptions{KeepComments: true, Tombstone: true},
+			expected: `
+name: web
+server:
+  # Networking
+
+  # removed: port
+  host: localhost
+  # end of networking
+list:
+  - a
+  - b
+`,
+		},
+		{
+			name: "tombstone for the last item",
+			path: Path{"list", -1},
+			opts: DeleteOptions{Tombstone: true},
+			expected: `
+name: web
+server:
+  # Networking
+
+  # the port
+  port: 80
+  host: localhost
+  # end of networking
+list:
+  - a
+  # removed: b
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, doc, err := yamlLoad(strings.TrimSpace(sectionsInput))
+			if err != nil {
+				t.Fatalf("Failed to load YAML: %v", err)
+			}
+
+			doc.EnableHistory()
+
+			if err := doc.DeleteAt(tc.path, tc.opts); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+
+			expectYAML(t, node, tc.expected)
+
+			if err := doc.Undo(); err != nil {
+				t.Fatalf("Failed to undo: %v", err)
+			}
+
+			expectYAML(t, node, sectionsInput)
+		})
+	}
+}
+
+func TestDeleteAtEmptiesCollection(t *testing.T) {
+	node, doc, err := yamlLoad(`list: [a]`)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.DeleteAt(Path{"list", 0}, DeleteOptions{Tombstone: true}); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	expectYAML(t, node, `list: [] # removed: a`)
+}
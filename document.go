@@ -4,9 +4,9 @@
 package yamled
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"regexp"
 
 	"gopkg.in/yaml.v3"
 )
@@ -23,8 +23,21 @@ type Document interface {
 	// This limitation does not apply to yamled.Node objects.
 	yaml.Marshaler
 
+	// Bytes encodes the document using its Format. If indent is
+	// greater than 0, it overrides the format's indentation. Blank lines
+	// between entries are only kept for documents created by Load(),
+	// LoadAll() or LoadFile(), as yaml.v3 does not record them.
 	Bytes(indent int) ([]byte, error)
+	// Encode uses the given encoder and its settings, ignoring the
+	// document's Format.
 	Encode(encoder *yaml.Encoder) error
+	SaveFile(path string, opts ...SaveOption) error
+
+	Format() Format
+	SetFormat(format Format) Document
+
+	// Clone returns a deep copy of the document, including its Format.
+	Clone() Document
 
 	RootNode() (Node, error)
 	Get(steps ...Step) (Node, bool)
@@ -38,12 +51,68 @@ type Document interface {
 	ReplaceKey(key Step, value interface{}) (Node, error)
 	ReplaceAt(path Path, value interface{}) (Node, error)
 
+	UpdateFrom(value interface{}) error
+	// Edit runs fn to modify the yaml.Node at the given path directly,
+	// for changes that cannot be made through the Document API. The
+	// change is recorded like all other changes.
+	Edit(path Path, fn func(n *yaml.Node) error) error
+
 	DeleteKey(steps ...Step) error
+	DeleteAt(path Path, opts DeleteOptions) error
+
+	// Transaction runs fn and rolls back all changes made through tx
+	// if fn returns an error or panics.
+	Transaction(fn func(tx Tx) error) error
+
+	// EnableHistory starts recording all changes made through the
+	// Document API, so they can be undone and redone.
+	EnableHistory()
+	DisableHistory()
+	CanUndo() bool
+	CanRedo() bool
+	Undo() error
+	Redo() error
+	// Group records all changes made by fn as a single history step.
+	Group(fn func() error) error
+	// ExportHistory serializes the history as YAML.
+	ExportHistory() ([]byte, error)
+	// ImportHistory restores the history from ExportHistory()'s
+	// output and enables it.
+	ImportHistory(data []byte) error
+
+	// Observe registers a function that is called for every change
+	// made through the Document API. The returned function removes
+	// the observer again.
+	Observe(fn ObserverFunc) (remove func())
+
+	Protect(patterns ...string) error
+	Unprotect()
+	IsReadOnly(path Path) bool
+
+	EnableKeyIndex()
+	DisableKeyIndex()
+
+	// DuplicateKeys returns all keys that occur more than once in
+	// their mapping, including the positions of all occurrences.
+	DuplicateKeys() []DuplicateKey
+	// SetDuplicateKeyPolicy determines which occurrence of a
+	// duplicate key is used when reading and changing the document.
+	SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) Document
+
+	// Markers returns all nodes marked with a line comment like
+	// "# yamled:image=web" or "# {"$imagepolicy": "ns:name"}".
+	Markers(name string) []Marker
+	// SetMarkers sets all nodes carrying the given marker at once.
+	SetMarkers(name string, value string, newValue interface{}) (int, error)
 
 	ToSlice() []interface{}
 	ToMap() map[string]interface{}
 	To(val interface{}) error
 
+	// Like for Node, the head comment does not include leading blank
+	// lines, which are kept when it is set. Previously, the leading line
+	// breaks of the yaml.Node's HeadComment were returned and replaced
+	// as well.
 	HeadComment() string
 	LineComment() string
 	FootComment() string
@@ -51,12 +120,45 @@ type Document interface {
 	SetHeadComment(comment string) Document
 	SetLineComment(comment string) Document
 	SetFootComment(comment string) Document
+
+	// CommentLines and its siblings work with comments as plain
+	// lines, without the "#" markers.
+	CommentLines(pos CommentPosition) []string
+	SetCommentLines(pos CommentPosition, lines ...string) Document
+	AppendCommentLine(pos CommentPosition, line string) Document
+	// StripComments removes all comments from the document.
+	StripComments() Document
+	// FindComments returns all comments matching the pattern.
+	FindComments(pattern *regexp.Regexp) []CommentMatch
+	// SetCommentBefore and SetCommentAfter set the comments around the
+	// entry at the given path; an empty path refers to the document.
+	SetCommentBefore(path Path, lines ...string) error
+	SetCommentAfter(path Path, lines ...string) error
+
+	// BlankLinesBefore and SetBlankLinesBefore control the number of
+	// blank lines before the entry at the given path.
+	BlankLinesBefore(path Path) int
+	SetBlankLinesBefore(path Path, count int) error
 }
 
 type document struct {
-	node *yaml.Node
+	node    *yaml.Node
+	format  Format
+	journal *journal
+	history *history
+	// changing is the number of running changes that are recorded as
+	// a whole, see run().
+	changing int
+
+	observers  []*observer
+	protection *protection
+	tree       *tree
 }
 
+// NewDocument wraps a decoded document node. As the source is not
+// available, the document uses the DefaultFormat() and the blank lines
+// between entries are not detected, so Bytes() removes them. Use Load()
+// to keep them.
 func NewDocument(n *yaml.Node) (Document, error) {
 	if n == nil {
 		return nil, errors.New("node cannot be nil")
@@ -66,31 +168,49 @@ func NewDocument(n *yaml.Node) (Document, error) {
 		return nil, fmt.Errorf("expected document node, but got %v", KindName(n.Kind))
 	}
 
-	return &document{
-		node: n,
-	}, nil
+	d := &document{
+		node:   n,
+		format: DefaultFormat(),
+		tree:   &tree{},
+	}
+	d.tree.doc = d
+
+	return d, nil
 }
 
 func (d *document) RootNode() (Node, error) {
-	return NewNode(d.node.Content[0])
+	n, err := NewNode(d.node.Content[0])
+	if err != nil {
+		return nil, err
+	}
+
+	n.(*node).tree = d.tree
+
+	return n, nil
 }
 
 func (d *document) Bytes(indent int) ([]byte, error) {
-	var buf bytes.Buffer
-	encoder := yaml.NewEncoder(&buf)
-	encoder.SetIndent(indent)
-
-	if err := encoder.Encode(d.node); err != nil {
-		return nil, err
+	format := d.format
+	if indent > 0 {
+		format.Indent = indent
 	}
 
-	return buf.Bytes(), nil
+	return format.encode(d.node)
 }
 
 func (d *document) Encode(encoder *yaml.Encoder) error {
 	return encoder.Encode(d.node)
 }
 
+func (d *document) Format() Format {
+	return d.format
+}
+
+func (d *document) SetFormat(format Format) Document {
+	d.format = format
+	return d
+}
+
 func (*document) MarshalYAML() (interface{}, error) {
 	panic("yamled.Document objects cannot be marshalled indirectly with a YAML encoder. Instead, use Bytes() or Encode() to get the desired results.")
 }
@@ -99,7 +219,7 @@ func (*document) MarshalYAML() (interface{}, error) {
 // comment API passthrough
 
 func (d *document) HeadComment() string {
-	return d.node.HeadComment
+	return headComment(d.node.HeadComment)
 }
 
 func (d *document) LineComment() string {
@@ -111,17 +231,17 @@ func (d *document) FootComment() string {
 }
 
 func (d *document) SetHeadComment(comment string) Document {
-	d.node.HeadComment = comment
+	d.setComment(CommentHead, withBlankLines(comment, blankLines(d.node.HeadComment)))
 	return d
 }
 
 func (d *document) SetLineComment(comment string) Document {
-	d.node.LineComment = comment
+	d.setComment(CommentLine, comment)
 	return d
 }
 
 func (d *document) SetFootComment(comment string) Document {
-	d.node.FootComment = comment
+	d.setComment(CommentFoot, comment)
 	return d
 }
 
@@ -164,7 +284,9 @@ func (d *document) Set(value interface{}) error {
 		return err
 	}
 
-	return n.Set(value)
+	return d.replace(nil, func() error {
+		return n.Set(value)
+	})
 }
 
 func (d *document) SetKey(key Step, value interface{}) (Node, error) {
@@ -173,7 +295,13 @@ func (d *document) SetKey(key Step, value interface{}) (Node, error) {
 		return nil, err
 	}
 
-	return n.SetKey(key, value)
+	var result Node
+	err = d.replace(Path{key}, func() (err error) {
+		result, err = n.SetKey(key, value)
+		return err
+	})
+
+	return result, err
 }
 
 func (d *document) SetAt(path Path, value interface{}) (Node, error) {
@@ -182,7 +310,13 @@ func (d *document) SetAt(path Path, value interface{}) (Node, error) {
 		return nil, err
 	}
 
-	return n.SetAt(path, value)
+	var result Node
+	err = d.replace(path, func() (err error) {
+		result, err = n.SetAt(path, value)
+		return err
+	})
+
+	return result, err
 }
 
 func (d *document) Replace(value interface{}) error {
@@ -191,7 +325,9 @@ func (d *document) Replace(value interface{}) error {
 		return err
 	}
 
-	return n.Replace(value)
+	return d.replace(nil, func() error {
+		return n.Replace(value)
+	})
 }
 
 func (d *document) ReplaceKey(key Step, value interface{}) (Node, error) {
@@ -200,7 +336,13 @@ func (d *document) ReplaceKey(key Step, value interface{}) (Node, error) {
 		return nil, err
 	}
 
-	return n.ReplaceKey(key, value)
+	var result Node
+	err = d.replace(Path{key}, func() (err error) {
+		result, err = n.ReplaceKey(key, value)
+		return err
+	})
+
+	return result, err
 }
 
 func (d *document) ReplaceAt(path Path, value interface{}) (Node, error) {
@@ -209,7 +351,71 @@ func (d *document) ReplaceAt(path Path, value interface{}) (Node, error) {
 		return nil, err
 	}
 
-	return n.ReplaceAt(path, value)
+	var result Node
+	err = d.replace(path, func() (err error) {
+		result, err = n.ReplaceAt(path, value)
+		return err
+	})
+
+	return result, err
+}
+
+func (d *document) UpdateFrom(value interface{}) error {
+	n, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	if !d.recording() || d.changing > 0 {
+		return n.UpdateFrom(value)
+	}
+
+	if err := d.readOnly(nil); err != nil {
+		return err
+	}
+
+	desired, err := createNode(value)
+	if err != nil {
+		return err
+	}
+
+	// record the individual changes instead of copying and comparing
+	// the entire document
+	r := reconciler{record: true}
+	_ = d.run(func() error {
+		r.node(Path{}, d.node.Content[0], desired)
+		return nil
+	})
+
+	d.tree.keyIndex().reset()
+
+	return d.commit(r.ops)
+}
+
+// Edit records the change made by fn as a replacement of the node at
+// the path, so it can be undone, is seen by observers and is checked
+// for protected nodes. The key index is rebuilt afterwards.
+func (d *document) Edit(path Path, fn func(n *yaml.Node) error) error {
+	root, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	target := rawNode(root)
+	if len(path) > 0 {
+		n, ok := root.Get(path...)
+		if !ok {
+			return fmt.Errorf("path %q not found", path.String())
+		}
+
+		target = rawNode(n)
+	}
+
+	defer d.tree.keyIndex().reset()
+
+	return d.mutate(path, func() error {
+		return fn(target)
+	})
 }
 
 /////////////////////////////////////////////////////////////////////
@@ -221,7 +427,9 @@ func (d *document) DeleteKey(steps ...Step) error {
 		return err
 	}
 
-	return n.DeleteKey(steps...)
+	return d.mutateDelete(steps, func() error {
+		return n.DeleteKey(steps...)
+	})
 }
 
 /////////////////////////////////////////////////////////////////////
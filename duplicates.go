@@ -0,0 +1,259 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DuplicateKeyPolicy determines how mappings with duplicate keys are
+// handled. yaml.v3 only rejects duplicate keys when decoding into
+// structs, so they can exist in any document.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicatesUseFirst reads and writes the first occurrence of a
+	// key. This is the default.
+	DuplicatesUseFirst DuplicateKeyPolicy = iota
+	// DuplicatesUseLast reads and writes the last occurrence of a
+	// key, which is what most YAML parsers do.
+	DuplicatesUseLast
+	// DuplicatesReject makes duplicate keys invisible to Get() and
+	// makes changes to them fail with a *DuplicateKeyError.
+	DuplicatesReject
+	// DuplicatesDedupeKeepFirst reads the first occurrence. When
+	// changing a duplicate key, all other occurrences are removed and
+	// their comments are merged into the first one.
+	DuplicatesDedupeKeepFirst
+	// DuplicatesDedupeKeepLast reads the last occurrence. When
+	// changing a duplicate key, all other occurrences are removed and
+	// their comments are merged into the last one.
+	DuplicatesDedupeKeepLast
+)
+
+// DuplicateKey describes a key that occurs more than once in a mapping.
+type DuplicateKey struct {
+	Path      Path
+	Positions []Position
+}
+
+// Position is a location in the source document. Nodes that were
+// added programmatically have no position (line and column are 0).
+type Position struct {
+	Line   int
+	Column int
+}
+
+// DuplicateKeyError is returned when changing a duplicate key while
+// the DuplicatesReject policy is active.
+type DuplicateKeyError struct {
+	Key       string
+	Positions []Position
+}
+
+func (e *DuplicateKeyError) Error() string {
+	lines := make([]string, 0, len(e.Positions))
+	for _, pos := range e.Positions {
+		lines = append(lines, fmt.Sprintf("%d", pos.Line))
+	}
+
+	return fmt.Sprintf("key %q is not unique (lines %s)", e.Key, strings.Join(lines, ", "))
+}
+
+func (d *document) SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) Document {
+	d.tree.duplicates = policy
+	return d
+}
+
+// DuplicateKeys returns all keys that occur more than once in their
+// mapping, in document order.
+func (d *document) DuplicateKeys() []DuplicateKey {
+	var result []DuplicateKey
+	findDuplicateKeys(d.node.Content[0], Path{}, &result)
+
+	return result
+}
+
+func findDuplicateKeys(n *yaml.Node, path Path, result *[]DuplicateKey) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		var (
+			keys      []string
+			positions = map[string][]Position{}
+		)
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				continue
+			}
+
+			if _, exists := positions[key.Value]; !exists {
+				keys = append(keys, key.Value)
+			}
+
+			positions[key.Value] = append(positions[key.Value], Position{Line: key.Line, Column: key.Column})
+		}
+
+		for _, key := range keys {
+			if len(positions[key]) > 1 {
+				*result = append(*result, DuplicateKey{
+					Path:      append(copyPath(path), key),
+					Positions: positions[key],
+				})
+			}
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			findDuplicateKeys(n.Content[i+1], append(copyPath(path), keyStep(n.Content[i])), result)
+		}
+
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			findDuplicateKeys(item, append(copyPath(path), i), result)
+		}
+	}
+}
+
+// findKey returns the position of the key (a string or KeyStep) in
+// the mapping's Content, or -1, according to the duplicate key policy.
+// If write is true, the caller intends to change the key, which can
+// lead to the removal of other occurrences.
+func (t *tree) findKey(mapping *yaml.Node, key Step, write bool) (int, error) {
+	policy := t.duplicateKeyPolicy()
+	if s, ok := key.(string); ok && policy == DuplicatesUseFirst {
+		return findKey(mapping, s, t.keyIndex()), nil
+	}
+
+	positions := keyPositions(mapping, key, t.keyIndex())
+
+	switch {
+	case len(positions) == 0:
+		return -1, nil
+	case len(positions) == 1 || policy == DuplicatesUseFirst:
+		return positions[0], nil
+	}
+
+	first := positions[0]
+	last := positions[len(positions)-1]
+
+	switch policy {
+	case DuplicatesUseLast:
+		return last, nil
+
+	case DuplicatesReject:
+		err := &DuplicateKeyError{Key: fmt.Sprintf("%v", key)}
+		for _, pos := range positions {
+			keyNode := mapping.Content[pos]
+			err.Positions = append(err.Positions, Position{Line: keyNode.Line, Column: keyNode.Column})
+		}
+
+		return -1, err
+
+	case DuplicatesDedupeKeepFirst:
+		if write {
+			return dedupeKey(mapping, positions, first, t.keyIndex()), nil
+		}
+
+		return first, nil
+
+	case DuplicatesDedupeKeepLast:
+		if write {
+			return dedupeKey(mapping, positions, last, t.keyIndex()), nil
+		}
+
+		return last, nil
+
+	default:
+		return first, nil
+	}
+}
+
+// dedupeKey removes all occurrences of a key except for the one at
+// keep, merges their comments into the kept key and value and returns
+// the new position of the kept key.
+func dedupeKey(mapping *yaml.Node, positions []int, keep int, index *keyIndex) int {
+	keptKey := mapping.Content[keep]
+	keptValue := mapping.Content[keep+1]
+
+	for _, pos := range positions {
+		if pos != keep {
+			mergeComments(keptKey, mapping.Content[pos])
+			mergeComments(keptValue, mapping.Content[pos+1])
+		}
+	}
+
+	index.invalidate(mapping)
+
+	// remove from the back, so the positions stay valid
+	newPos := keep
+	for i := len(positions) - 1; i >= 0; i-- {
+		pos := positions[i]
+		if pos == keep {
+			continue
+		}
+
+		index.removed(mapping.Content[pos+1])
+		mapping.Content = append(mapping.Content[:pos], mapping.Content[pos+2:]...)
+		if pos < keep {
+			newPos -= 2
+		}
+	}
+
+	return newPos
+}
+
+func mergeComments(dst *yaml.Node, src *yaml.Node) {
+	dst.HeadComment = joinComments(dst.HeadComment, src.HeadComment)
+	dst.FootComment = joinComments(dst.FootComment, src.FootComment)
+
+	// a line comment must stay on a single line, so "# a" and "# b"
+	// become "# a; b"
+	switch {
+	case dst.LineComment == "":
+		dst.LineComment = src.LineComment
+	case src.LineComment != "" && src.LineComment != dst.LineComment:
+		dst.LineComment += "; " + strings.TrimLeft(strings.TrimPrefix(src.LineComment, "#"), " ")
+	}
+}
+
+func joinComments(a, b string) string {
+	switch {
+	case b == "" || a == b:
+		return a
+	case a == "":
+		return b
+	default:
+		return a + "\n" + b
+	}
+}
+
+// firstDuplicate returns the position of the first step in the path
+// that refers to a duplicate key, or -1. With the default policy, this
+// is always -1, as the first occurrence is used everywhere.
+func (d *document) firstDuplicate(path Path) int {
+	if d.tree.duplicateKeyPolicy() == DuplicatesUseFirst {
+		return -1
+	}
+
+	current := d.node.Content[0]
+
+	for i, step := range path {
+		if isKeyStep(step) && current.Kind == yaml.MappingNode && len(keyPositions(current, step, nil)) > 1 {
+			return i
+		}
+
+		index := childIndex(current, step)
+		if index < 0 {
+			return -1
+		}
+
+		current = childAt(current, index)
+	}
+
+	return -1
+}
@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const duplicatesInput = `
+# first
+foo: a
+bar:
+  baz: 1
+  baz: 2
+# second
+foo: b
+`
+
+func TestDuplicateKeys(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(duplicatesInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	duplicates := doc.DuplicateKeys()
+	if len(duplicates) != 2 {
+		t.Fatalf("Expected 2 duplicate keys, but got %v.", duplicates)
+	}
+
+	if duplicates[0].Path.String() != "foo" || len(duplicates[0].Positions) != 2 || duplicates[0].Positions[1].Line != 7 {
+		t.Fatalf("Unexpected first duplicate: %+v", duplicates[0])
+	}
+
+	if duplicates[1].Path.String() != "bar.baz" || duplicates[1].Positions[0].Line != 4 || duplicates[1].Positions[0].Column != 3 {
+		t.Fatalf("Unexpected second duplicate: %+v", duplicates[1])
+	}
+}
+
+func TestDuplicateKeyPolicies(t *testing.T) {
+	testcases := []struct {
+		name     string
+		policy   DuplicateKeyPolicy
+		read     string
+		expected string
+		err      bool
+	}{
+		{
+			name:   "use first",
+			policy: DuplicatesUseFirst,
+			read:   "a",
+			expected: `
+# first
+foo: x
+bar:
+  baz: 1
+  baz: 2
+# second
+foo: b
+`,
+		},
+		{
+			name:   "use last",
+			policy: DuplicatesUseLast,
+			read:   "b",
+			expected: `
+# first
+foo: a
+bar:
+  baz: 1
+  baz: 2
+# second
+foo: x
+`,
+		},
+		{
+			name:   "reject",
+			policy: DuplicatesReject,
+			err:    true,
+		},
+		{
+			name:   "dedupe and keep first",
+			policy: DuplicatesDedupeKeepFirst,
+			read:   "a",
+			expected: `
+# first
+# second
+foo: x
+bar:
+  baz: 1
+  baz: 2
+`,
+		},
+		{
+			name:   "dedupe and keep last",
+			policy: DuplicatesDedupeKeepLast,
+			read:   "b",
+			expected: `
+bar:
+  baz: 1
+  baz: 2
+# second
+# first
+foo: x
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, doc, err := yamlLoad(strings.TrimSpace(duplicatesInput))
+			if err != nil {
+				t.Fatalf("Failed to load YAML: %v", err)
+			}
+
+			doc.SetDuplicateKeyPolicy(tc.policy)
+
+			value, found := doc.Get("foo")
+			if found != (tc.read != "") {
+				t.Fatalf("Expected found=%v, but got %v.", tc.read != "", found)
+			}
+
+			if found && value.ToString() != tc.read {
+				t.Fatalf("Expected to read %q, but got %q.", tc.read, value.ToString())
+			}
+
+			_, err = doc.SetKey("foo", "x")
+			if tc.err {
+				var dupErr *DuplicateKeyError
+				if !errors.As(err, &dupErr) {
+					t.Fatalf("Expected a DuplicateKeyError, but got %v.", err)
+				}
+
+				if len(dupErr.Positions) != 2 {
+					t.Fatalf("Expected 2 positions, but got %v.", dupErr.Positions)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to set key: %v", err)
+			}
+
+			expectYAML(t, node, tc.expected)
+		})
+	}
+}
+
+func TestDuplicateKeysInPaths(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+spec:
+  a: 1
+spec:
+  b: 2
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.SetDuplicateKeyPolicy(DuplicatesDedupeKeepLast)
+	doc.EnableHistory()
+
+	if _, err := doc.SetAt(Path{"spec", "c"}, 3); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+
+	expectYAML(t, node, `
+spec:
+  b: 2
+  c: 3
+`)
+
+	if len(doc.DuplicateKeys()) != 0 {
+		t.Fatalf("Expected no more duplicate keys, but got %v.", doc.DuplicateKeys())
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	expectYAML(t, node, `
+spec:
+  a: 1
+spec:
+  b: 2
+`)
+
+	if err := doc.DeleteKey("spec"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	expectYAML(t, node, `{}`)
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	if len(doc.DuplicateKeys()) != 1 {
+		t.Fatalf("Expected duplicate keys to be restored, but got %v.", doc.DuplicateKeys())
+	}
+}
+
+func TestDuplicateKeysLineComments(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+foo: # one
+  a: 1
+foo: # two
+  b: 2
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.SetDuplicateKeyPolicy(DuplicatesDedupeKeepFirst)
+
+	if _, err := doc.SetAt(Path{"foo", "c"}, 3); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+
+	// line comments cannot span multiple lines
+	expectYAML(t, node, `
+foo: # one; two
+  a: 1
+  c: 3
+`)
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EqualOptions control how strict Equal() compares nodes. The zero
+// value compares everything. Aliases are always resolved and
+// compared by their target.
+type EqualOptions struct {
+	// IgnoreComments ignores head, line and foot comments.
+	IgnoreComments bool
+	// IgnoreStyles ignores quoting, flow/block styles and differences
+	// in how numbers and booleans are written (e.g. 0x1F vs 31).
+	IgnoreStyles bool
+	// IgnoreKeyOrder compares mappings regardless of the order of
+	// their keys.
+	IgnoreKeyOrder bool
+	// IgnoreTags compares scalars only by their value, so that the
+	// string "1" equals the integer 1.
+	IgnoreTags bool
+}
+
+// SemanticEqual are the options to check whether two nodes represent
+// the same data, regardless of formatting.
+var SemanticEqual = EqualOptions{
+	IgnoreComments: true,
+	IgnoreStyles:   true,
+	IgnoreKeyOrder: true,
+}
+
+// Equal compares two nodes deeply.
+func Equal(a, b Node, opts EqualOptions) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return equalNodes(rawNode(a), rawNode(b), opts)
+}
+
+func equalNodes(a, b *yaml.Node, opts EqualOptions) bool {
+	a = resolveAlias(a)
+	b = resolveAlias(b)
+
+	if a.Kind != b.Kind {
+		return false
+	}
+
+	if !opts.IgnoreComments && (a.HeadComment != b.HeadComment || a.LineComment != b.LineComment || a.FootComment != b.FootComment) {
+		return false
+	}
+
+	if !opts.IgnoreStyles && a.Style != b.Style {
+		return false
+	}
+
+	switch a.Kind {
+	case yaml.ScalarNode:
+		return equalScalars(a, b, opts)
+
+	case yaml.SequenceNode, yaml.DocumentNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+
+		for i := range a.Content {
+			if !equalNodes(a.Content[i], b.Content[i], opts) {
+				return false
+			}
+		}
+
+		return true
+
+	case yaml.MappingNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+
+		if !opts.IgnoreKeyOrder {
+			for i := range a.Content {
+				if !equalNodes(a.Content[i], b.Content[i], opts) {
+					return false
+				}
+			}
+
+			return true
+		}
+
+		matched := make([]bool, len(b.Content)/2)
+
+	outer:
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			for j := 0; j+1 < len(b.Content); j += 2 {
+				if matched[j/2] || !equalNodes(a.Content[i], b.Content[j], opts) {
+					continue
+				}
+
+				if !equalNodes(a.Content[i+1], b.Content[j+1], opts) {
+					return false
+				}
+
+				matched[j/2] = true
+				continue outer
+			}
+
+			return false
+		}
+
+		return true
+
+	default:
+		return false
+	}
+}
+
+func equalScalars(a, b *yaml.Node, opts EqualOptions) bool {
+	if !opts.IgnoreTags && a.ShortTag() != b.ShortTag() {
+		return false
+	}
+
+	if opts.IgnoreStyles {
+		return canonicalValue(a) == canonicalValue(b)
+	}
+
+	return a.Value == b.Value
+}
+
+// canonicalValue returns a normalized representation of a scalar,
+// so that different notations of the same number, boolean or null
+// result in the same value.
+func canonicalValue(n *yaml.Node) string {
+	switch n.ShortTag() {
+	case "!!null":
+		return "null"
+
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err == nil {
+			return strconv.FormatBool(b)
+		}
+
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+
+		var u uint64
+		if err := n.Decode(&u); err == nil {
+			return strconv.FormatUint(u, 10)
+		}
+
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	}
+
+	return n.Value
+}
+
+// Hash returns a stable hash of the node's data. Comments, styles and
+// the order of keys are not part of the hash, but tags are, so two
+// nodes have the same hash if (and, barring collisions, only if) they
+// are Equal() using the SemanticEqual options.
+func Hash(n Node) string {
+	h := sha256.New()
+	hashNode(h, rawNode(n))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashNode(h hash.Hash, n *yaml.Node) {
+	n = resolveAlias(n)
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, child := range n.Content {
+			hashNode(h, child)
+		}
+
+	case yaml.ScalarNode:
+		writeHashToken(h, n.ShortTag())
+		writeHashToken(h, canonicalValue(n))
+
+	case yaml.SequenceNode:
+		writeHashToken(h, "[")
+		for _, item := range n.Content {
+			hashNode(h, item)
+		}
+		writeHashToken(h, "]")
+
+	case yaml.MappingNode:
+		// hash each pair individually and then sort them,
+		// to make the result independent of the key order
+		pairs := make([]string, 0, len(n.Content)/2)
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pair := sha256.New()
+			hashNode(pair, n.Content[i])
+			hashNode(pair, n.Content[i+1])
+
+			pairs = append(pairs, string(pair.Sum(nil)))
+		}
+
+		sort.Strings(pairs)
+
+		writeHashToken(h, "{")
+		for _, pair := range pairs {
+			writeHashToken(h, pair)
+		}
+		writeHashToken(h, "}")
+	}
+}
+
+// writeHashToken writes a length-prefixed token, so that
+// concatenated tokens cannot be ambiguous.
+func writeHashToken(h hash.Hash, token string) {
+	h.Write([]byte(strconv.Itoa(len(token))))
+	h.Write([]byte{':'})
+	h.Write([]byte(token))
+}
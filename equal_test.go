@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+func loadRootNode(t *testing.T, input string) Node {
+	_, doc, err := yamlLoad(strings.TrimSpace(input))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	root, err := doc.RootNode()
+	if err != nil {
+		t.Fatalf("Failed to get root node: %v", err)
+	}
+
+	return root
+}
+
+func TestEqual(t *testing.T) {
+	base := `
+# comment
+name: web
+replicas: 3
+ports: [80, 443]
+`
+
+	testcases := []struct {
+		name     string
+		other    string
+		opts     EqualOptions
+		expected bool
+	}{
+		{
+			name:     "identical",
+			other:    base,
+			expected: true,
+		},
+		{
+			name:     "different comment",
+			other:    "# other\nname: web\nreplicas: 3\nports: [80, 443]",
+			expected: false,
+		},
+		{
+			name:     "ignored comment",
+			other:    "name: web # other\nreplicas: 3\nports: [80, 443]",
+			opts:     EqualOptions{IgnoreComments: true},
+			expected: true,
+		},
+		{
+			name:     "different style",
+			other:    "# comment\nname: 'web'\nreplicas: 0x3\nports:\n  - 80\n  - 443",
+			opts:     EqualOptions{IgnoreComments: true},
+			expected: false,
+		},
+		{
+			name:     "ignored style",
+			other:    "# comment\nname: 'web'\nreplicas: 0x3\nports:\n  - 80\n  - 443",
+			opts:     EqualOptions{IgnoreStyles: true},
+			expected: true,
+		},
+		{
+			name:     "different key order",
+			other:    "# comment\nreplicas: 3\nname: web\nports: [80, 443]",
+			opts:     EqualOptions{IgnoreComments: true},
+			expected: false,
+		},
+		{
+			name:     "ignored key order",
+			other:    "replicas: 3\nports: [80, 443]\nname: web",
+			opts:     SemanticEqual,
+			expected: true,
+		},
+		{
+			name:     "different tags",
+			other:    `{name: web, replicas: "3", ports: [80, 443]}`,
+			opts:     SemanticEqual,
+			expected: false,
+		},
+		{
+			name:     "ignored tags",
+			other:    `{name: web, replicas: "3", ports: [80, 443]}`,
+			opts:     EqualOptions{IgnoreComments: true, IgnoreStyles: true, IgnoreTags: true},
+			expected: true,
+		},
+		{
+			name:     "different values",
+			other:    "name: web\nreplicas: 3\nports: [80, 444]",
+			opts:     SemanticEqual,
+			expected: false,
+		},
+		{
+			name:     "additional key",
+			other:    "name: web\nreplicas: 3\nports: [80, 443]\ndebug: true",
+			opts:     SemanticEqual,
+			expected: false,
+		},
+	}
+
+	a := loadRootNode(t, base)
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := loadRootNode(t, tc.other)
+
+			if result := Equal(a, b, tc.opts); result != tc.expected {
+				t.Fatalf("Expected Equal() to return %v, but got %v.", tc.expected, result)
+			}
+
+			if result := Equal(b, a, tc.opts); result != tc.expected {
+				t.Fatalf("Expected Equal() to be symmetric, but got %v.", result)
+			}
+		})
+	}
+}
+
+func TestEqualResolvesAliases(t *testing.T) {
+	a := loadRootNode(t, "base: &b {x: 1}\ncopy: *b")
+	b := loadRootNode(t, "base: {x: 1}\ncopy: {x: 1}")
+
+	if !Equal(a, b, SemanticEqual) {
+		t.Fatal("Expected aliases to be resolved.")
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := loadRootNode(t, "# comment\nname: web\nports: [80, 0x1BB]\nenabled: yes")
+	b := loadRootNode(t, "ports:\n  - 80\n  - 443\nenabled: yes\nname: 'web'")
+	c := loadRootNode(t, "ports:\n  - 80\n  - 443\nenabled: yes\nname: 'web2'")
+	d := loadRootNode(t, "ports:\n  - '80'\n  - 443\nenabled: yes\nname: web")
+
+	if Hash(a) != Hash(b) {
+		t.Error("Expected semantically equal nodes to have the same hash.")
+	}
+
+	if Hash(a) == Hash(c) {
+		t.Error("Expected different values to result in different hashes.")
+	}
+
+	if Hash(a) == Hash(d) {
+		t.Error("Expected different tags to result in different hashes.")
+	}
+
+	if Hash(a) != Hash(a) {
+		t.Error("Expected hash to be stable.")
+	}
+}
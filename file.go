@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load decodes a single YAML document. The document remembers the
+// source's indentation, line endings, trailing newline and the blank
+// lines between entries, so that SaveFile() can reproduce them.
+func Load(data []byte) (Document, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var node yaml.Node
+	if err := decoder.Decode(&node); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("input does not contain a YAML document")
+		}
+
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	var extra yaml.Node
+	if err := decoder.Decode(&extra); !errors.Is(err, io.EOF) {
+		return nil, errors.New("input contains more than one YAML document")
+	}
+
+	return loadDocument(data, &node)
+}
+
+// LoadAll decodes all documents of a multi-document YAML stream. Like
+// Load(), each document remembers the source's formatting and the blank
+// lines between its entries.
+func LoadAll(data []byte) ([]Document, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var docs []Document
+	for {
+		var node yaml.Node
+
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML in document %d: %w", len(docs), err)
+		}
+
+		doc, err := loadDocument(data, &node)
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// loadDocument creates a document for a node decoded from the source
+// and detects the source's formatting.
+func loadDocument(source []byte, node *yaml.Node) (Document, error) {
+	doc, err := NewDocument(node)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.(*document).format = detectFormat(source, node)
+	detectBlankLines(source, node)
+
+	return doc, nil
+}
+
+// LoadFile reads and decodes a single YAML document from a file.
+func LoadFile(path string) (Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(data)
+}
+
+// LoadFileFS reads and decodes a single YAML document from a file
+// in the given filesystem.
+func LoadFileFS(fsys fs.FS, name string) (Document, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(data)
+}
+
+type saveOptions struct {
+	mode          os.FileMode
+	skipUnchanged bool
+}
+
+// SaveOption configures the behaviour of Document.SaveFile().
+type SaveOption func(*saveOptions)
+
+// WithFileMode sets the file mode for newly created files. Existing
+// files always retain their mode. The default is 0644.
+func WithFileMode(mode os.FileMode) SaveOption {
+	return func(o *saveOptions) {
+		o.mode = mode
+	}
+}
+
+// SkipUnchanged prevents writing the file if its content would not
+// change, leaving its modification time untouched.
+func SkipUnchanged() SaveOption {
+	return func(o *saveOptions) {
+		o.skipUnchanged = true
+	}
+}
+
+func (d *document) SaveFile(path string, opts ...SaveOption) error {
+	data, err := d.format.encode(d.node)
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(path, data, opts...)
+}
+
+// WriteFile writes already encoded YAML like Document.SaveFile(), i.e.
+// atomically, retaining the mode of existing files and following
+// symlinks. This is useful for content that is not a single document,
+// like multi-document streams.
+func WriteFile(path string, data []byte, opts ...SaveOption) error {
+	options := saveOptions{
+		mode: 0o644,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// do not replace symlinks with regular files
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		options.mode = info.Mode().Perm()
+
+		if options.skipUnchanged {
+			existing, err := os.ReadFile(path)
+			if err == nil && bytes.Equal(existing, data) {
+				return nil
+			}
+		}
+
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	return writeFileAtomic(path, data, options.mode)
+}
+
+// writeFileAtomic writes the data into a temporary file in the same
+// directory and then renames it, so that readers never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	cleanup := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		return cleanup(err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return cleanup(err)
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		return cleanup(err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return cleanup(err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func writeTestFile(t *testing.T, content string, mode os.FileMode) string {
+	filename := filepath.Join(t.TempDir(), "test.yaml")
+
+	if err := os.WriteFile(filename, []byte(content), mode); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	return filename
+}
+
+func expectFileContent(t *testing.T, filename string, expected string) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	if string(content) != expected {
+		t.Fatalf("Expected\n---\n%q\n---\n\nbut got\n\n---\n%q\n---", expected, string(content))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, input := range []string{"", "foo: [", "a: 1\n---\nb: 2\n"} {
+		if _, err := Load([]byte(input)); err == nil {
+			t.Errorf("Should not have been able to load %q.", input)
+		}
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	input := "a:\n- 1\n\n- 2\n---\nb:\n    c: 1\n\n    d: 2\n"
+
+	docs, err := LoadAll([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to load documents: %v", err)
+	}
+
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents, but got %d.", len(docs))
+	}
+
+	for i, expected := range []string{"a:\n- 1\n\n- 2\n", "b:\n    c: 1\n\n    d: 2\n"} {
+		encoded, err := docs[i].Bytes(0)
+		if err != nil {
+			t.Fatalf("Failed to encode document: %v", err)
+		}
+
+		if string(encoded) != expected {
+			t.Errorf("Expected document %d to be %q, but got %q.", i, expected, string(encoded))
+		}
+	}
+
+	if _, err := LoadAll([]byte("a: 1\n---\nb: [")); err == nil {
+		t.Error("Should not have been able to load invalid YAML.")
+	}
+}
+
+func TestSaveFilePreservesFormatting(t *testing.T) {
+	testcases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "4 spaces",
+			input:    "# config\nfoo:\n    # comment\n    bar: 1\n",
+			expected: "# config\nfoo:\n    # comment\n    bar: 2\n",
+		},
+		{
+			name:     "3 spaces, no trailing newline",
+			input:    "foo:\n   bar: 1",
+			expected: "foo:\n   bar: 2",
+		},
+		{
+			name:     "CRLF",
+			input:    "foo:\r\n  bar: 1\r\n",
+			expected: "foo:\r\n  bar: 2\r\n",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := writeTestFile(t, tc.input, 0o600)
+
+			doc, err := LoadFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to load file: %v", err)
+			}
+
+			if err := doc.MustGet("foo", "bar").Set(2); err != nil {
+				t.Fatalf("Failed to set value: %v", err)
+			}
+
+			if err := doc.SaveFile(filename); err != nil {
+				t.Fatalf("Failed to save file: %v", err)
+			}
+
+			expectFileContent(t, filename, tc.expected)
+
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatalf("Failed to stat file: %v", err)
+			}
+
+			if info.Mode().Perm() != 0o600 {
+				t.Fatalf("Expected file mode to be preserved, but got %v.", info.Mode())
+			}
+
+			entries, err := os.ReadDir(filepath.Dir(filename))
+			if err != nil {
+				t.Fatalf("Failed to list directory: %v", err)
+			}
+
+			if len(entries) != 1 {
+				t.Fatalf("Expected no temporary files to remain, but found %d files.", len(entries))
+			}
+		})
+	}
+}
+
+func TestSaveFileNewFile(t *testing.T) {
+	doc, err := Load([]byte("foo: bar\n"))
+	if err != nil {
+		t.Fatalf("Failed to load document: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "new.yaml")
+
+	if err := doc.SaveFile(filename, WithFileMode(0o640)); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	expectFileContent(t, filename, "foo: bar\n")
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+
+	if info.Mode().Perm() != 0o640 {
+		t.Fatalf("Expected file mode 0640, but got %v.", info.Mode())
+	}
+}
+
+func TestSaveFileSkipUnchanged(t *testing.T) {
+	filename := writeTestFile(t, "foo: bar\n", 0o644)
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filename, past, past); err != nil {
+		t.Fatalf("Failed to change file times: %v", err)
+	}
+
+	doc, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to load file: %v", err)
+	}
+
+	if err := doc.SaveFile(filename, SkipUnchanged()); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+
+	if !info.ModTime().Equal(past) {
+		t.Fatal("Expected unchanged file not to be written.")
+	}
+}
+
+func TestLoadFileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config/app.yaml": &fstest.MapFile{Data: []byte("foo:\n    bar: baz\n")},
+	}
+
+	doc, err := LoadFileFS(fsys, "config/app.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load file: %v", err)
+	}
+
+	if value := doc.MustGet("foo", "bar").ToString(); value != "baz" {
+		t.Fatalf("Expected foo.bar to be \"baz\", but got %q.", value)
+	}
+
+	if _, err := LoadFileFS(fsys, "nonexisting.yaml"); err == nil {
+		t.Fatal("Should not have been able to load a non-existing file.")
+	}
+}
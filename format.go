@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"bytes"
+	"errors"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format describes the textual layout of a document. Documents loaded
+// via Load() or LoadFile() detect the format of their source, so that
+// they can be written back in the same style.
+type Format struct {
+	// Indent is the number of spaces used for each nesting level.
+	Indent int
+	// CompactSequences is true if block sequences inside mappings are
+	// not indented, i.e. the "- " is placed at the column of the
+	// parent key.
+	CompactSequences bool
+	// LineEnding is either "\n" (also used if left empty) or "\r\n".
+	LineEnding string
+	// TrailingNewline is true if the document ends with a line break.
+	TrailingNewline bool
+}
+
+const defaultIndent = 2
+
+// DefaultFormat returns the format used for documents that were not
+// loaded from a source, matching yaml.v3's encoder (except for using
+// 2 instead of 4 spaces for indentation).
+func DefaultFormat() Format {
+	return Format{
+		Indent:          defaultIndent,
+		LineEnding:      "\n",
+		TrailingNewline: true,
+	}
+}
+
+// DetectFormat determines the formatting of the given YAML source. If
+// the source does not contain enough nested structures to determine the
+// indentation, the defaults are used.
+func DetectFormat(source []byte) (Format, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(source, &node); err != nil {
+		return Format{}, err
+	}
+
+	return detectFormat(source, &node), nil
+}
+
+func (f Format) validate() error {
+	if f.Indent < 0 {
+		return errors.New("indent must be >= 0")
+	}
+
+	if f.LineEnding != "" && f.LineEnding != "\n" && f.LineEnding != "\r\n" {
+		return errors.New(`line ending must be either "\n" or "\r\n"`)
+	}
+
+	return nil
+}
+
+// detectFormat determines the formatting of the given source, with
+// node being its already decoded document.
+func detectFormat(source []byte, node *yaml.Node) Format {
+	f := DefaultFormat()
+
+	if bytes.Contains(source, []byte("\r\n")) {
+		f.LineEnding = "\r\n"
+	}
+
+	f.TrailingNewline = len(source) == 0 || bytes.HasSuffix(source, []byte("\n"))
+
+	if indent := detectIndent(node); indent > 0 {
+		f.Indent = indent
+	}
+
+	if compact, found := detectCompactSequences(node); found {
+		f.CompactSequences = compact
+	}
+
+	return f
+}
+
+// detectIndent returns the difference in columns between the first
+// key of a block mapping and the key it is nested in, or 0 if the
+// document contains no nested mappings.
+func detectIndent(n *yaml.Node) int {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			if indent := detectIndent(child); indent > 0 {
+				return indent
+			}
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			value := n.Content[i+1]
+
+			if value.Kind == yaml.MappingNode && isBlock(value) && len(value.Content) > 0 && value.Line > key.Line {
+				if indent := value.Column - key.Column; indent > 0 {
+					return indent
+				}
+			}
+
+			if indent := detectIndent(value); indent > 0 {
+				return indent
+			}
+		}
+	}
+
+	return 0
+}
+
+// detectCompactSequences checks the first block sequence that is the
+// value of a mapping key and returns true if the sequence is not
+// indented. The second return value is false if no such sequence exists.
+func detectCompactSequences(n *yaml.Node) (bool, bool) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			if compact, found := detectCompactSequences(child); found {
+				return compact, found
+			}
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			value := n.Content[i+1]
+
+			if value.Kind == yaml.SequenceNode && isBlock(value) && len(value.Content) > 0 && value.Line > key.Line {
+				return value.Column == key.Column, true
+			}
+
+			if compact, found := detectCompactSequences(value); found {
+				return compact, found
+			}
+		}
+	}
+
+	return false, false
+}
+
+func isBlock(n *yaml.Node) bool {
+	return n.Style&yaml.FlowStyle == 0
+}
+
+// encode marshals the node using the given format.
+func (f Format) encode(n *yaml.Node) ([]byte, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	indent := f.Indent
+	if indent == 0 {
+		indent = defaultIndent
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+
+	if err := encoder.Encode(n); err != nil {
+		return nil, err
+	}
+
+	encoded := trimBlankLines(buf.Bytes())
+
+	if f.CompactSequences {
+		var err error
+
+		encoded, err = compactSequences(encoded, indent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !f.TrailingNewline {
+		encoded = bytes.TrimRight(encoded, "\n")
+	}
+
+	if f.LineEnding == "\r\n" {
+		encoded = bytes.ReplaceAll(encoded, []byte("\n"), []byte(f.LineEnding))
+	}
+
+	return encoded, nil
+}
+
+// compactSequences post-processes the output of yaml.v3, which always
+// indents block sequences inside mappings. The encoded YAML is parsed
+// again to find the lines belonging to each such sequence, which are
+// then shifted to the left by one indentation level.
+func compactSequences(encoded []byte, indent int) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(encoded, &doc); err != nil {
+		return nil, err
+	}
+
+	lines := bytes.SplitAfter(encoded, []byte("\n"))
+	levels := make([]int, len(lines))
+
+	// end is the (1-based, exclusive) line number at which the
+	// current node ends at the latest
+	var walk func(n *yaml.Node, end int)
+	walk = func(n *yaml.Node, end int) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, child := range n.Content {
+				walk(child, end)
+			}
+
+		case yaml.SequenceNode:
+			for i, item := range n.Content {
+				itemEnd := end
+				if i+1 < len(n.Content) {
+					itemEnd = n.Content[i+1].Line
+				}
+
+				walk(item, itemEnd)
+			}
+
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i]
+				value := n.Content[i+1]
+
+				valueEnd := end
+				if i+2 < len(n.Content) {
+					valueEnd = n.Content[i+2].Line
+				}
+
+				if value.Kind == yaml.SequenceNode && isBlock(value) && value.Line > key.Line {
+					// comments belonging to the next key are less indented
+					// than the sequence and must not be touched
+					threshold := value.Column - 1
+
+					// the head comment of the first item is rendered above
+					// value.Line and needs to be moved as well
+					start := value.Line
+					for start-1 > key.Line && isCommentOrBlankLine(lines[start-2]) {
+						start--
+					}
+
+					for l := start; l < valueEnd && l <= len(lines); l++ {
+						if leadingSpaces(lines[l-1]) >= threshold && !isBlankLine(lines[l-1]) {
+							levels[l-1]++
+						}
+					}
+				}
+
+				walk(value, valueEnd)
+			}
+		}
+	}
+
+	walk(&doc, len(lines)+1)
+
+	var result bytes.Buffer
+	result.Grow(len(encoded))
+
+	for i, line := range lines {
+		remove := levels[i] * indent
+		if spaces := leadingSpaces(line); remove > spaces {
+			remove = spaces
+		}
+
+		result.Write(line[remove:])
+	}
+
+	return result.Bytes(), nil
+}
+
+func leadingSpaces(line []byte) int {
+	return len(line) - len(bytes.TrimLeft(line, " "))
+}
+
+func isCommentOrBlankLine(line []byte) bool {
+	return isBlankLine(line) || bytes.HasPrefix(bytes.TrimSpace(line), []byte("#"))
+}
+
+func isBlankLine(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	testcases := []struct {
+		name     string
+		input    string
+		expected Format
+	}{
+		{
+			name:     "flat document",
+			input:    "foo: bar\n",
+			expected: DefaultFormat(),
+		},
+		{
+			name:     "4 spaces, indented sequences",
+			input:    "foo:\n    bar: 1\nlist:\n    - a\n",
+			expected: Format{Indent: 4, LineEnding: "\n", TrailingNewline: true},
+		},
+		{
+			name:     "compact sequences",
+			input:    "list:\n- a: 1\n  b:\n    c: 2\n",
+			expected: Format{Indent: 2, CompactSequences: true, LineEnding: "\n", TrailingNewline: true},
+		},
+		{
+			name:     "flow styles are ignored",
+			input:    "foo: {a: 1}\nlist: [1, 2]\nnested:\n   - x",
+			expected: Format{Indent: 2, LineEnding: "\n", TrailingNewline: false},
+		},
+		{
+			name:     "CRLF",
+			input:    "foo:\r\n   bar: 1\r\n",
+			expected: Format{Indent: 3, LineEnding: "\r\n", TrailingNewline: true},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			detected, err := DetectFormat([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("Failed to detect format: %v", err)
+			}
+
+			if detected != tc.expected {
+				t.Fatalf("Expected %+v, but got %+v.", tc.expected, detected)
+			}
+		})
+	}
+}
+
+func TestCompactSequencesRoundtrip(t *testing.T) {
+	input := strings.TrimLeft(`
+# head comment
+list:
+# about the first item
+- first # line comment
+- key: value
+  nested:
+  # about a
+  - a
+  - |
+    literal
+    text
+  # foot of nested
+  other:
+    deep:
+    - x
+- - inner
+  - sequence
+# about the next key
+mapping:
+  seq:
+  - 1
+  flow: [1, 2]
+last: value
+`, "\n")
+
+	doc, err := Load([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to load document: %v", err)
+	}
+
+	if !doc.Format().CompactSequences {
+		t.Fatal("Expected compact sequences to be detected.")
+	}
+
+	encoded, err := doc.Bytes(0)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	if string(encoded) != input {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", input, string(encoded))
+	}
+}
+
+func TestOverrideFormat(t *testing.T) {
+	doc, err := Load([]byte("list:\n- a\nfoo:\n  bar: 1\n"))
+	if err != nil {
+		t.Fatalf("Failed to load document: %v", err)
+	}
+
+	format := doc.Format()
+	format.CompactSequences = false
+	format.Indent = 4
+
+	encoded, err := doc.SetFormat(format).Bytes(0)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	expected := "list:\n    - a\nfoo:\n    bar: 1\n"
+	if string(encoded) != expected {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expected, string(encoded))
+	}
+
+	// explicit indentation overrides the format
+	encoded, err = doc.Bytes(2)
+	if err != nil {
+		t.Fatalf("Failed to encode document: %v", err)
+	}
+
+	expected = "list:\n  - a\nfoo:\n  bar: 1\n"
+	if string(encoded) != expected {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expected, string(encoded))
+	}
+}
@@ -0,0 +1,401 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+type history struct {
+	// undo and redo are stacks of steps; each step is a group of
+	// operations that are undone/redone together.
+	undo [][]operation
+	redo [][]operation
+
+	// groupDepth is the number of currently running Group() calls,
+	// group collects their operations.
+	groupDepth int
+	group      []operation
+}
+
+func (h *history) add(ops []operation) {
+	if h.groupDepth > 0 {
+		h.group = append(h.group, ops...)
+		return
+	}
+
+	h.undo = append(h.undo, ops)
+	h.redo = nil
+}
+
+func (d *document) EnableHistory() {
+	if d.history == nil {
+		d.history = &history{}
+	}
+}
+
+// DisableHistory stops recording changes and discards the history.
+func (d *document) DisableHistory() {
+	d.history = nil
+}
+
+func (d *document) CanUndo() bool {
+	return d.history != nil && len(d.history.undo) > 0
+}
+
+func (d *document) CanRedo() bool {
+	return d.history != nil && len(d.history.redo) > 0
+}
+
+// Undo reverts the most recent step in the history.
+func (d *document) Undo() error {
+	if !d.CanUndo() {
+		return ErrNothingToUndo
+	}
+
+	if err := d.checkHistoryNavigation(); err != nil {
+		return err
+	}
+
+	h := d.history
+	step := h.undo[len(h.undo)-1]
+
+	if err := d.revert(step); err != nil {
+		return err
+	}
+
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, step)
+
+	return nil
+}
+
+// Redo re-applies the most recently undone step.
+func (d *document) Redo() error {
+	if !d.CanRedo() {
+		return ErrNothingToRedo
+	}
+
+	if err := d.checkHistoryNavigation(); err != nil {
+		return err
+	}
+
+	h := d.history
+	step := h.redo[len(h.redo)-1]
+
+	for _, op := range step {
+		if err := d.apply(op, false); err != nil {
+			return fmt.Errorf("failed to redo change to %v: %w", op.path, err)
+		}
+
+		d.notifyApplied(op)
+	}
+
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, step)
+
+	return nil
+}
+
+func (d *document) checkHistoryNavigation() error {
+	if d.journal != nil {
+		return errors.New("cannot undo or redo during a transaction")
+	}
+
+	if d.history.groupDepth > 0 {
+		return errors.New("cannot undo or redo during a group")
+	}
+
+	return nil
+}
+
+// Group records all changes made by fn as a single step in the
+// history. Unlike a transaction, the changes are kept even if fn
+// returns an error. If the history is disabled, fn is simply called.
+func (d *document) Group(fn func() error) error {
+	h := d.history
+	if h == nil {
+		return fn()
+	}
+
+	h.groupDepth++
+
+	defer func() {
+		h.groupDepth--
+
+		if h.groupDepth == 0 {
+			ops := h.group
+			h.group = nil
+
+			if len(ops) > 0 {
+				h.add(ops)
+			}
+		}
+	}()
+
+	return fn()
+}
+
+/////////////////////////////////////////////////////////////////////
+// serialization
+
+type serializedHistory struct {
+	Undo [][]serializedOperation `yaml:"undo"`
+	Redo [][]serializedOperation `yaml:"redo"`
+}
+
+type serializedOperation struct {
+	Op   string `yaml:"op"`
+	Path []Step `yaml:"path,flow"`
+
+	Index *int      `yaml:"index,omitempty"`
+	Key   yaml.Node `yaml:"key,omitempty"`
+	Old   yaml.Node `yaml:"old,omitempty"`
+	New   yaml.Node `yaml:"new,omitempty"`
+
+	Comment    string  `yaml:"comment,omitempty"`
+	Target     string  `yaml:"target,omitempty"`
+	OldComment *string `yaml:"oldComment,omitempty"`
+	NewComment *string `yaml:"newComment,omitempty"`
+}
+
+var (
+	operationNames = map[operationKind]string{
+		opReplace: "replace",
+		opInsert:  "insert",
+		opRemove:  "remove",
+		opComment: "comment",
+	}
+
+	commentFieldNames = map[CommentPosition]string{
+		CommentHead: "head",
+		CommentLine: "line",
+		CommentFoot: "foot",
+	}
+
+	// comments on the document itself have no target
+	commentOwnerNames = map[commentOwner]string{
+		commentOnNode: "node",
+		commentOnKey:  "key",
+	}
+)
+
+func (d *document) ExportHistory() ([]byte, error) {
+	if d.history == nil {
+		return nil, errors.New("history is not enabled")
+	}
+
+	serialized := serializedHistory{
+		Undo: serializeSteps(d.history.undo),
+		Redo: serializeSteps(d.history.redo),
+	}
+
+	return yaml.Marshal(serialized)
+}
+
+func (d *document) ImportHistory(data []byte) error {
+	var serialized serializedHistory
+	if err := yaml.Unmarshal(data, &serialized); err != nil {
+		return fmt.Errorf("invalid history: %w", err)
+	}
+
+	undo, err := deserializeSteps(serialized.Undo)
+	if err != nil {
+		return err
+	}
+
+	redo, err := deserializeSteps(serialized.Redo)
+	if err != nil {
+		return err
+	}
+
+	d.history = &history{
+		undo: undo,
+		redo: redo,
+	}
+
+	return nil
+}
+
+func serializeSteps(steps [][]operation) [][]serializedOperation {
+	result := make([][]serializedOperation, 0, len(steps))
+
+	for _, step := range steps {
+		ops := make([]serializedOperation, 0, len(step))
+		for _, op := range step {
+			ops = append(ops, serializeOperation(op))
+		}
+
+		result = append(result, ops)
+	}
+
+	return result
+}
+
+func serializeOperation(op operation) serializedOperation {
+	result := serializedOperation{
+		Op:   operationNames[op.kind],
+		Path: op.path,
+	}
+
+	if result.Path == nil {
+		result.Path = Path{}
+	}
+
+	switch op.kind {
+	case opComment:
+		oldComment, newComment := op.oldComment, op.newComment
+
+		result.Comment = commentFieldNames[op.comment]
+		result.Target = commentOwnerNames[op.owner]
+		result.OldComment = &oldComment
+		result.NewComment = &newComment
+
+	case opInsert, opRemove:
+		index := op.index
+		result.Index = &index
+
+		if op.key != nil {
+			result.Key = *op.key
+		}
+	}
+
+	if op.oldValue != nil {
+		result.Old = *op.oldValue
+	}
+
+	if op.newValue != nil {
+		result.New = *op.newValue
+	}
+
+	return result
+}
+
+func deserializeSteps(steps [][]serializedOperation) ([][]operation, error) {
+	result := make([][]operation, 0, len(steps))
+
+	for _, step := range steps {
+		ops := make([]operation, 0, len(step))
+
+		for _, serialized := range step {
+			op, err := deserializeOperation(serialized)
+			if err != nil {
+				return nil, err
+			}
+
+			ops = append(ops, op)
+		}
+
+		result = append(result, ops)
+	}
+
+	return result, nil
+}
+
+func deserializeOperation(serialized serializedOperation) (operation, error) {
+	op := operation{
+		path: make(Path, 0, len(serialized.Path)),
+	}
+
+	for _, step := range serialized.Path {
+		op.path = append(op.path, decodeStep(step))
+	}
+
+	kindFound := false
+	for kind, name := range operationNames {
+		if name == serialized.Op {
+			op.kind = kind
+			kindFound = true
+		}
+	}
+
+	if !kindFound {
+		return op, fmt.Errorf("invalid operation %q", serialized.Op)
+	}
+
+	if err := op.path.Validate(); err != nil {
+		return op, fmt.Errorf("invalid path in %s operation: %w", serialized.Op, err)
+	}
+
+	if serialized.Index != nil {
+		op.index = *serialized.Index
+	}
+
+	if !serialized.Key.IsZero() {
+		op.key = cloneNode(&serialized.Key)
+	}
+
+	if !serialized.Old.IsZero() {
+		op.oldValue = cloneNode(&serialized.Old)
+	}
+
+	if !serialized.New.IsZero() {
+		op.newValue = cloneNode(&serialized.New)
+	}
+
+	switch op.kind {
+	case opComment:
+		fieldFound := false
+		for field, name := range commentFieldNames {
+			if name == serialized.Comment {
+				op.comment = field
+				fieldFound = true
+			}
+		}
+
+		if !fieldFound {
+			return op, fmt.Errorf("invalid comment field %q", serialized.Comment)
+		}
+
+		if serialized.Target != "" {
+			ownerFound := false
+			for owner, name := range commentOwnerNames {
+				if name == serialized.Target {
+					op.owner = owner
+					ownerFound = true
+				}
+			}
+
+			if !ownerFound {
+				return op, fmt.Errorf("invalid comment target %q", serialized.Target)
+			}
+		}
+
+		if op.owner == commentOnKey && len(op.path) == 0 {
+			return op, errors.New("comment operation on a key requires a non-empty path")
+		}
+
+		if serialized.OldComment != nil {
+			op.oldComment = *serialized.OldComment
+		}
+
+		if serialized.NewComment != nil {
+			op.newComment = *serialized.NewComment
+		}
+
+	case opInsert, opRemove:
+		if serialized.Index == nil {
+			return op, fmt.Errorf("%s operation requires an index", serialized.Op)
+		}
+
+		if len(op.path) == 0 {
+			return op, fmt.Errorf("%s operation requires a non-empty path", serialized.Op)
+		}
+
+	case opReplace:
+		if op.oldValue == nil || op.newValue == nil {
+			return op, errors.New("replace operation requires old and new values")
+		}
+	}
+
+	return op, nil
+}
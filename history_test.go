@@ -0,0 +1,476 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHistoryUndoRedo(t *testing.T) {
+	input := strings.TrimSpace(`
+# head comment
+name: web
+spec:
+  replicas: 3
+list: [a, b]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if doc.CanUndo() {
+		t.Fatal("Should not be able to undo without history.")
+	}
+
+	doc.EnableHistory()
+
+	if _, err := doc.SetKey("name", "api"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"spec", "ports", 0}, 80); err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+
+	if err := doc.DeleteKey("list", 0); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	doc.SetHeadComment("new head")
+
+	changed := `
+# new head
+
+# head comment
+name: api
+spec:
+  replicas: 3
+  ports:
+    - 80
+list: [b]
+`
+
+	expectYAML(t, node, changed)
+
+	for i := 0; i < 4; i++ {
+		if err := doc.Undo(); err != nil {
+			t.Fatalf("Failed to undo step %d: %v", i, err)
+		}
+	}
+
+	expectYAML(t, node, input)
+
+	if err := doc.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("Expected ErrNothingToUndo, but got %v.", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := doc.Redo(); err != nil {
+			t.Fatalf("Failed to redo step %d: %v", i, err)
+		}
+	}
+
+	expectYAML(t, node, changed)
+
+	if doc.CanRedo() {
+		t.Fatal("Should not be able to redo anymore.")
+	}
+
+	// a new change after undoing clears the redo stack
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	if _, err := doc.SetKey("name", "other"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if doc.CanRedo() {
+		t.Fatal("Expected new change to clear the redo stack.")
+	}
+}
+
+func TestHistoryGroups(t *testing.T) {
+	input := strings.TrimSpace(`
+a: 1
+b: 2
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	err = doc.Group(func() error {
+		if _, err := doc.SetKey("a", 10); err != nil {
+			return err
+		}
+
+		return doc.DeleteKey("b")
+	})
+	if err != nil {
+		t.Fatalf("Failed to run group: %v", err)
+	}
+
+	// transactions are recorded as a single step as well
+	err = doc.Transaction(func(tx Tx) error {
+		if _, err := tx.SetKey("c", 3); err != nil {
+			return err
+		}
+
+		_, err := tx.SetKey("d", 4)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+
+	expectYAML(t, node, "a: 10\nc: 3\nd: 4")
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	expectYAML(t, node, "a: 10")
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	expectYAML(t, node, input)
+
+	if doc.CanUndo() {
+		t.Fatal("Expected history to contain exactly two steps.")
+	}
+}
+
+func TestHistoryExportImport(t *testing.T) {
+	input := strings.TrimSpace(`
+# comment
+name: web
+list:
+  - a
+  - b
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	if _, err := doc.SetKey("name", nil); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"list", 2}, "0"); err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+
+	if err := doc.DeleteKey("list", 0); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	doc.SetFootComment("the end")
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	exported, err := doc.ExportHistory()
+	if err != nil {
+		t.Fatalf("Failed to export history: %v", err)
+	}
+
+	changed := `
+# comment
+name: null
+list:
+  - b
+  - "0"
+`
+
+	expectYAML(t, node, changed)
+
+	// continue in a new document with the same content
+	node2, doc2, err := yamlLoad(strings.TrimSpace(changed))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc2.ImportHistory(exported); err != nil {
+		t.Fatalf("Failed to import history: %v", err)
+	}
+
+	if err := doc2.Redo(); err != nil {
+		t.Fatalf("Failed to redo: %v", err)
+	}
+
+	expectYAML(t, node2, changed+"\n# the end\n")
+
+	for i := 0; i < 4; i++ {
+		if err := doc2.Undo(); err != nil {
+			t.Fatalf("Failed to undo step %d: %v\n\nHistory:\n%s", i, err, exported)
+		}
+	}
+
+	expectYAML(t, node2, input)
+}
+
+func TestHistoryNodeComments(t *testing.T) {
+	input := strings.TrimSpace(`
+# comment
+name: web # the name
+spec:
+  replicas: 3
+list:
+  - a
+  - b
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	var changes []Change
+	doc.Observe(func(c Change) error {
+		changes = append(changes, c)
+		return nil
+	})
+
+	key, ok := doc.GetKey("spec")
+	if !ok {
+		t.Fatal("Expected to find key node.")
+	}
+
+	key.SetHeadComment("# the spec")
+	doc.MustGet("spec", "replicas").SetLineComment("# scaled")
+	doc.MustGet("list", 0).SetCommentLines(CommentHead, "first item")
+
+	if err := doc.SetCommentAfter(Path{"name"}, "after the name"); err != nil {
+		t.Fatalf("Failed to set comment: %v", err)
+	}
+
+	if err := doc.SetBlankLinesBefore(Path{"list"}, 1); err != nil {
+		t.Fatalf("Failed to set blank lines: %v", err)
+	}
+
+	expectYAML(t, node, `
+# comment
+name: web # the name
+# after the name
+
+# the spec
+spec:
+  replicas: 3 # scaled
+
+list:
+  # first item
+  - a
+  - b
+`)
+
+	if len(changes) != 5 {
+		t.Fatalf("Expected 5 changes, but got %d.", len(changes))
+	}
+
+	if first := changes[0]; first.Kind != ChangeComment || !first.OnKey || first.Position != CommentHead || first.Path.String() != "spec" {
+		t.Fatalf("Expected head comment change on key spec, but got %+v.", first)
+	}
+
+	root, err := doc.RootNode()
+	if err != nil {
+		t.Fatalf("Failed to get root node: %v", err)
+	}
+
+	root.StripComments()
+
+	stripped := `
+name: web
+spec:
+  replicas: 3
+
+list:
+  - a
+  - b
+`
+
+	expectYAML(t, node, stripped)
+
+	exported, err := doc.ExportHistory()
+	if err != nil {
+		t.Fatalf("Failed to export history: %v", err)
+	}
+
+	// continue in a new document with the same content; blank lines
+	// are only detected by Load()
+	doc2, err := Load([]byte(strings.TrimSpace(stripped)))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc2.ImportHistory(exported); err != nil {
+		t.Fatalf("Failed to import history: %v", err)
+	}
+
+	for _, d := range []Document{doc, doc2} {
+		for i := 0; i < 6; i++ {
+			if err := d.Undo(); err != nil {
+				t.Fatalf("Failed to undo step %d: %v\n\nHistory:\n%s", i, err, exported)
+			}
+		}
+
+		if d.CanUndo() {
+			t.Fatal("Should have undone all changes.")
+		}
+	}
+
+	expectYAML(t, node, input)
+	expectYAML(t, doc2.(*document).node, input)
+}
+
+func TestHistoryRelativeIndexes(t *testing.T) {
+	input := strings.TrimSpace(`
+list: [a, b]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	var paths []string
+	doc.Observe(func(c Change) error {
+		paths = append(paths, c.Path.String())
+		return nil
+	})
+
+	if _, err := doc.SetAt(Path{"list", End}, "c"); err != nil {
+		t.Fatalf("Failed to append item: %v", err)
+	}
+
+	if err := doc.DeleteKey("list", -3); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"list", -1}, "C"); err != nil {
+		t.Fatalf("Failed to set item: %v", err)
+	}
+
+	// recorded paths refer to the actual positions
+	if expected := "list.[2] list.[0] list.[1]"; strings.Join(paths, " ") != expected {
+		t.Fatalf("Expected paths %q, but got %q.", expected, strings.Join(paths, " "))
+	}
+
+	expectYAML(t, node, `list: [b, C]`)
+
+	for doc.CanUndo() {
+		if err := doc.Undo(); err != nil {
+			t.Fatalf("Failed to undo: %v", err)
+		}
+	}
+
+	expectYAML(t, node, input)
+}
+
+func TestHistoryCommentOnSetNode(t *testing.T) {
+	node, doc, err := yamlLoad(`a: 1`)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	value, err := doc.SetAt(Path{"b"}, "x")
+	if err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+
+	// the returned node still belongs to the document
+	value.SetLineComment("hello")
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo comment: %v", err)
+	}
+
+	expectYAML(t, node, `
+a: 1
+b: x
+`)
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo value: %v", err)
+	}
+
+	expectYAML(t, node, `a: 1`)
+
+	for i := 0; i < 2; i++ {
+		if err := doc.Redo(); err != nil {
+			t.Fatalf("Failed to redo: %v", err)
+		}
+	}
+
+	expectYAML(t, node, `
+a: 1
+b: x # hello
+`)
+}
+
+func TestHistoryNodeChanges(t *testing.T) {
+	input := strings.TrimSpace(`
+spec:
+  replicas: 1
+  ports: [80, 443]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	spec := doc.MustGet("spec")
+
+	if _, err := spec.SetAt(Path{"ports", End}, 8080); err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+
+	if err := spec.DeleteKey("replicas"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	if err := doc.MustGet("spec", "ports").UpdateFrom([]int{443}); err != nil {
+		t.Fatalf("Failed to update node: %v", err)
+	}
+
+	expectYAML(t, node, `
+spec:
+  ports: [443]
+`)
+
+	for i := 0; i < 3; i++ {
+		if err := doc.Undo(); err != nil {
+			t.Fatalf("Failed to undo: %v", err)
+		}
+	}
+
+	if doc.CanUndo() {
+		t.Fatal("Expected no more changes to undo.")
+	}
+
+	expectYAML(t, node, input)
+}
@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyIndexThreshold is the minimum number of keys a mapping must have
+// to be indexed; scanning small mappings is faster than hashing.
+const keyIndexThreshold = 16
+
+// keyIndex maps keys to their positions for all large mappings in a
+// document. Indexes are built lazily when a key is looked up and are
+// shared by all nodes of a document.
+type keyIndex struct {
+	lock     sync.Mutex
+	mappings map[*yaml.Node]*mappingIndex
+}
+
+type mappingIndex struct {
+	// positions maps each key to the position of its first
+	// occurrence in the mapping's Content.
+	positions map[string]int
+	// duplicates maps keys that occur more than once to all of their
+	// positions.
+	duplicates map[string][]int
+	// length is the mapping's Content length when the index was
+	// built; a different length means the index is outdated.
+	length int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		mappings: map[*yaml.Node]*mappingIndex{},
+	}
+}
+
+// EnableKeyIndex speeds up looking up keys in large mappings by
+// building an index for each mapping on first access. The index is
+// kept up to date for all changes made through yamled, including
+// Document.Edit(). If the underlying yaml.Nodes are modified directly,
+// adding, removing or reordering keys is detected, but renaming a key
+// is not; call DisableKeyIndex() and EnableKeyIndex() afterwards to
+// rebuild the index in that case.
+func (d *document) EnableKeyIndex() {
+	if d.tree.index == nil {
+		d.tree.index = newKeyIndex()
+	}
+}
+
+func (d *document) DisableKeyIndex() {
+	d.tree.index = nil
+}
+
+// findKey returns the position of the key node in the mapping's
+// Content, or -1. The index is optional.
+func findKey(mapping *yaml.Node, key string, index *keyIndex) int {
+	if index != nil && len(mapping.Content) >= 2*keyIndexThreshold {
+		return index.lookup(mapping, key)
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if isKey(mapping.Content[i], key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// findKeys returns the positions of all occurrences of the key in the
+// mapping's Content. The index is optional.
+func findKeys(mapping *yaml.Node, key string, index *keyIndex) []int {
+	if index != nil && len(mapping.Content) >= 2*keyIndexThreshold {
+		return index.lookupAll(mapping, key)
+	}
+
+	var positions []int
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if isKey(mapping.Content[i], key) {
+			positions = append(positions, i)
+		}
+	}
+
+	return positions
+}
+
+func isKey(n *yaml.Node, key string) bool {
+	return n.Kind == yaml.ScalarNode && n.Value == key
+}
+
+func (i *keyIndex) lookup(mapping *yaml.Node, key string) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	m := i.mappings[mapping]
+	if m == nil || m.length != len(mapping.Content) {
+		m = i.build(mapping)
+	}
+
+	// the index is updated on every change, so a miss is final and
+	// adding new keys does not require scanning the mapping
+	pos, ok := m.positions[key]
+	if !ok {
+		return -1
+	}
+
+	if pos+1 < len(mapping.Content) && isKey(mapping.Content[pos], key) {
+		return pos
+	}
+
+	// keys have been moved around (e.g. by sorting)
+	m = i.build(mapping)
+
+	pos, ok = m.positions[key]
+	if !ok {
+		return -1
+	}
+
+	return pos
+}
+
+func (i *keyIndex) lookupAll(mapping *yaml.Node, key string) []int {
+	first := i.lookup(mapping, key)
+	if first < 0 {
+		return nil
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	duplicates := i.mappings[mapping].duplicates[key]
+	if len(duplicates) == 0 {
+		return []int{first}
+	}
+
+	for _, pos := range duplicates {
+		if pos+1 >= len(mapping.Content) || !isKey(mapping.Content[pos], key) {
+			duplicates = i.build(mapping).duplicates[key]
+			break
+		}
+	}
+
+	return append([]int{}, duplicates...)
+}
+
+func (i *keyIndex) build(mapping *yaml.Node) *mappingIndex {
+	m := &mappingIndex{
+		positions: make(map[string]int, len(mapping.Content)/2),
+		length:    len(mapping.Content),
+	}
+
+	for pos := 0; pos+1 < len(mapping.Content); pos += 2 {
+		keyNode := mapping.Content[pos]
+		if keyNode.Kind != yaml.ScalarNode {
+			continue
+		}
+
+		m.add(keyNode.Value, pos)
+	}
+
+	i.mappings[mapping] = m
+
+	return m
+}
+
+// appended updates the index after a key was appended to the mapping,
+// so that adding many keys does not require rebuilding the index
+// each time.
+func (i *keyIndex) appended(mapping *yaml.Node, key *yaml.Node) {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	m := i.mappings[mapping]
+	if m == nil {
+		return
+	}
+
+	pos := len(mapping.Content) - 2
+	if m.length != pos {
+		delete(i.mappings, mapping)
+		return
+	}
+
+	if key.Kind == yaml.ScalarNode {
+		m.add(key.Value, pos)
+	}
+
+	m.length = len(mapping.Content)
+}
+
+func (m *mappingIndex) add(key string, pos int) {
+	first, exists := m.positions[key]
+	if !exists {
+		m.positions[key] = pos
+		return
+	}
+
+	if m.duplicates == nil {
+		m.duplicates = map[string][]int{}
+	}
+
+	if len(m.duplicates[key]) == 0 {
+		m.duplicates[key] = []int{first}
+	}
+
+	m.duplicates[key] = append(m.duplicates[key], pos)
+}
+
+// invalidate drops the index for the given nodes.
+func (i *keyIndex) invalidate(nodes ...*yaml.Node) {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for _, n := range nodes {
+		delete(i.mappings, n)
+	}
+}
+
+// removed drops the indexes for all mappings in the given subtrees,
+// which have been removed from or replaced in the document.
+func (i *keyIndex) removed(nodes ...*yaml.Node) {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if len(i.mappings) == 0 {
+		return
+	}
+
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n == nil {
+			return
+		}
+
+		delete(i.mappings, n)
+
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+
+	for _, n := range nodes {
+		walk(n)
+	}
+}
+
+// reset drops all indexes.
+func (i *keyIndex) reset() {
+	if i == nil {
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.mappings = map[*yaml.Node]*mappingIndex{}
+}
@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func largeDocument(tb testing.TB, keys int) Document {
+	var buf strings.Builder
+	for i := 0; i < keys; i++ {
+		fmt.Fprintf(&buf, "key%d: value%d\n", i, i)
+	}
+
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(buf.String()), &n); err != nil {
+		tb.Fatalf("Failed to decode YAML: %v", err)
+	}
+
+	doc, err := NewDocument(&n)
+	if err != nil {
+		tb.Fatalf("Failed to create document: %v", err)
+	}
+
+	return doc
+}
+
+func TestKeyIndex(t *testing.T) {
+	doc := largeDocument(t, 100)
+	doc.EnableKeyIndex()
+
+	expectValue := func(key string, expected string) {
+		t.Helper()
+
+		value, ok := doc.Get(key)
+		if expected == "" {
+			if ok {
+				t.Fatalf("Expected %s to not exist, but got %q.", key, value.ToString())
+			}
+
+			return
+		}
+
+		if !ok {
+			t.Fatalf("Expected %s to exist, but it does not.", key)
+		}
+
+		if value.ToString() != expected {
+			t.Fatalf("Expected %s to be %q, but got %q.", key, expected, value.ToString())
+		}
+	}
+
+	expectValue("key50", "value50")
+	expectValue("nonexisting", "")
+
+	if _, err := doc.SetKey("new", "hello"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	expectValue("new", "hello")
+
+	if err := doc.DeleteKey("key10"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	expectValue("key10", "")
+	expectValue("key50", "value50")
+
+	// delete and add a key, so the mapping has the same length as before
+	if err := doc.DeleteKey("key20"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	if _, err := doc.SetKey("other", "world"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	expectValue("key20", "")
+	expectValue("other", "world")
+
+	root, err := doc.RootNode()
+	if err != nil {
+		t.Fatalf("Failed to get root node: %v", err)
+	}
+
+	// reorder the keys directly, so that all positions change
+	raw, _ := root.MarshalYAML()
+	content := raw.(*yaml.Node).Content
+	for i, j := 0, len(content)-2; i < j; i, j = i+2, j-2 {
+		content[i], content[i+1], content[j], content[j+1] = content[j], content[j+1], content[i], content[i+1]
+	}
+
+	expectValue("key99", "value99")
+	expectValue("other", "world")
+
+	if _, ok := doc.GetKey("key1"); !ok {
+		t.Fatal("Expected to find key node.")
+	}
+
+	doc.EnableHistory()
+
+	if err := doc.Set(map[string]string{"replaced": "yes"}); err != nil {
+		t.Fatalf("Failed to replace document: %v", err)
+	}
+
+	expectValue("key99", "")
+	expectValue("replaced", "yes")
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	expectValue("key99", "value99")
+	expectValue("replaced", "")
+}
+
+func TestKeyIndexRenamedKey(t *testing.T) {
+	doc := largeDocument(t, 100)
+	doc.EnableKeyIndex()
+
+	if _, ok := doc.Get("key50"); !ok {
+		t.Fatal("Expected to find key50.")
+	}
+
+	// rename a key without changing the mapping's length
+	if err := doc.Edit(nil, func(root *yaml.Node) error {
+		root.Content[100].Value = "renamed"
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to rename key: %v", err)
+	}
+
+	if _, ok := doc.Get("key50"); ok {
+		t.Fatal("Expected key50 to not exist anymore.")
+	}
+
+	value, ok := doc.Get("renamed")
+	if !ok {
+		t.Fatal("Expected to find renamed key.")
+	}
+
+	if value.ToString() != "value50" {
+		t.Fatalf("Expected renamed key to be value50, but got %q.", value.ToString())
+	}
+}
+
+func TestKeyIndexRemovedMappings(t *testing.T) {
+	var buf strings.Builder
+	buf.WriteString("items:\n")
+	for item := 0; item < 3; item++ {
+		for i := 0; i < 20; i++ {
+			prefix := "   "
+			if i == 0 {
+				prefix = " - "
+			}
+
+			fmt.Fprintf(&buf, "%skey%d: value%d\n", prefix, i, i)
+		}
+	}
+
+	doc, err := Load([]byte(buf.String()))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableKeyIndex()
+	index := doc.(*document).tree.index
+
+	for item := 0; item < 3; item++ {
+		if _, ok := doc.Get("items", item, "key5"); !ok {
+			t.Fatalf("Expected to find items[%d].key5.", item)
+		}
+	}
+
+	if len(index.mappings) != 3 {
+		t.Fatalf("Expected 3 indexed mappings, but got %d.", len(index.mappings))
+	}
+
+	if _, err := doc.ReplaceAt(Path{"items", 0}, "replaced"); err != nil {
+		t.Fatalf("Failed to replace item: %v", err)
+	}
+
+	if err := doc.DeleteKey("items", 1); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	if err := doc.DeleteAt(Path{"items", Where("key0", "value0")}, DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	if len(index.mappings) != 0 {
+		t.Fatalf("Expected no indexed mappings, but got %d.", len(index.mappings))
+	}
+}
+
+func benchmarkLookups(b *testing.B, keys int, indexed bool) {
+	doc := largeDocument(b, keys)
+	if indexed {
+		doc.EnableKeyIndex()
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("key%d", (i*7919)%keys)
+
+		if _, ok := doc.Get(key); !ok {
+			b.Fatalf("Failed to find %s.", key)
+		}
+	}
+}
+
+func benchmarkUpdates(b *testing.B, keys int, indexed bool) {
+	doc := largeDocument(b, keys)
+	if indexed {
+		doc.EnableKeyIndex()
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("key%d", (i*7919)%keys)
+
+		if _, err := doc.SetKey(key, "updated"); err != nil {
+			b.Fatalf("Failed to set %s: %v", key, err)
+		}
+
+		if _, err := doc.SetKey(fmt.Sprintf("added%d", i), "new"); err != nil {
+			b.Fatalf("Failed to add key: %v", err)
+		}
+	}
+}
+
+func benchmarkInserts(b *testing.B, keys int, indexed bool) {
+	doc := largeDocument(b, keys)
+	if indexed {
+		doc.EnableKeyIndex()
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := doc.SetKey(fmt.Sprintf("added%d", i), "new"); err != nil {
+			b.Fatalf("Failed to add key: %v", err)
+		}
+	}
+}
+
+func BenchmarkGet100kKeys(b *testing.B) {
+	b.Run("linear", func(b *testing.B) { benchmarkLookups(b, 100_000, false) })
+	b.Run("indexed", func(b *testing.B) { benchmarkLookups(b, 100_000, true) })
+}
+
+func BenchmarkSetKey100kKeys(b *testing.B) {
+	b.Run("linear", func(b *testing.B) { benchmarkUpdates(b, 100_000, false) })
+	b.Run("indexed", func(b *testing.B) { benchmarkUpdates(b, 100_000, true) })
+}
+
+func BenchmarkAddKey100kKeys(b *testing.B) {
+	b.Run("linear", func(b *testing.B) { benchmarkInserts(b, 100_000, false) })
+	b.Run("indexed", func(b *testing.B) { benchmarkInserts(b, 100_000, true) })
+}
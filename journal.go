@@ -0,0 +1,901 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The journal records all changes made through the Document API as
+// invertible operations, so that they can be rolled back later on.
+// Operations address nodes by their path, which is stable as long as
+// operations are undone in the reverse order of their recording.
+
+type operationKind int
+
+const (
+	// opReplace means the node at the path was changed in-place.
+	opReplace operationKind = iota
+	// opInsert means a new item (and its key) was inserted into the
+	// parent of the path.
+	opInsert
+	// opRemove means an item (and its key) was removed from the
+	// parent of the path.
+	opRemove
+	// opComment means a comment on the document node, or on the node
+	// or key at the path was changed.
+	opComment
+)
+
+// commentOwner is the node whose comment is changed by an opComment.
+type commentOwner int
+
+const (
+	commentOnDocument commentOwner = iota
+	commentOnNode
+	commentOnKey
+)
+
+type operation struct {
+	kind operationKind
+	path Path
+
+	// index is the position in the parent's Content where the item
+	// was inserted or removed; for mappings this is the position of
+	// the key node.
+	index int
+	// key is the key node for mapping items, nil for sequence items.
+	key *yaml.Node
+
+	oldValue *yaml.Node
+	newValue *yaml.Node
+
+	owner      commentOwner
+	comment    CommentPosition
+	oldComment string
+	newComment string
+}
+
+type journal struct {
+	operations []operation
+	// depth is the number of currently running transactions.
+	depth int
+}
+
+// recording returns true if changes to the document need to be
+// turned into operations.
+func (d *document) recording() bool {
+	return d.journal != nil || d.history != nil || len(d.observers) > 0 || d.protection != nil
+}
+
+// commit notifies all observers about the operations and records
+// them. If a read-only node was modified or an observer vetoes, the
+// operations are reverted instead.
+func (d *document) commit(ops []operation) error {
+	if err := d.checkProtection(ops); err != nil {
+		for i := len(ops) - 1; i >= 0; i-- {
+			if revertErr := d.apply(ops[i], true); revertErr != nil {
+				return fmt.Errorf("%w (additionally, reverting the change failed: %v)", err, revertErr)
+			}
+		}
+
+		return err
+	}
+
+	if err := d.notify(ops); err != nil {
+		return err
+	}
+
+	d.record(ops)
+
+	return nil
+}
+
+// record appends operations to the journal of the running transaction
+// or, if there is none, to the history.
+func (d *document) record(ops []operation) {
+	if len(ops) == 0 {
+		return
+	}
+
+	if d.journal != nil {
+		d.journal.operations = append(d.journal.operations, ops...)
+		return
+	}
+
+	if d.history != nil {
+		d.history.add(ops)
+	}
+}
+
+// rollback undoes all journaled operations after the given position
+// and removes them from the journal.
+func (d *document) rollback(position int) error {
+	ops := d.journal.operations
+
+	if err := d.revert(ops[position:]); err != nil {
+		return err
+	}
+
+	d.journal.operations = ops[:position]
+
+	return nil
+}
+
+// revert undoes the operations in reverse order.
+func (d *document) revert(ops []operation) error {
+	for i := len(ops) - 1; i >= 0; i-- {
+		if err := d.apply(ops[i], true); err != nil {
+			return fmt.Errorf("failed to undo change to %v: %w", ops[i].path, err)
+		}
+
+		d.notifyReverted(ops[i])
+	}
+
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// recording changes
+
+// mutate runs fn, which changes the document at the given path, and
+// turns the changes into operations.
+func (d *document) mutate(path Path, fn func() error) error {
+	return d.mutatePath(path, false, fn)
+}
+
+// replace is like mutate, but fn must replace the node at the path
+// with a new node instead of changing it, so that the old node does
+// not have to be copied.
+func (d *document) replace(path Path, fn func() error) error {
+	return d.mutatePath(path, true, fn)
+}
+
+func (d *document) mutatePath(path Path, replacing bool, fn func() error) error {
+	if !d.recording() {
+		return fn()
+	}
+
+	path = d.concretePath(path)
+
+	// fail before changing anything; protected children of the node are
+	// checked after the change, as only then it is known whether they
+	// were modified
+	if err := d.readOnly(path); err != nil {
+		return err
+	}
+
+	change := d.prepareChange(path, replacing)
+	err := d.run(fn)
+
+	if vetoErr := d.commit(change.operations(d)); vetoErr != nil {
+		return vetoErr
+	}
+
+	return err
+}
+
+// mutateDelete runs fn, which removes the node at the given path,
+// and turns the change into an operation.
+func (d *document) mutateDelete(path Path, fn func() error) error {
+	if !d.recording() || len(path) == 0 {
+		return fn()
+	}
+
+	path = d.concretePath(path)
+
+	if err := d.readOnly(path); err != nil {
+		return err
+	}
+
+	// removing a duplicate key can remove multiple pairs
+	if d.firstDuplicate(path) >= 0 {
+		return d.mutate(path, fn)
+	}
+
+	parent := lookupPath(d.node.Content[0], path.Parent())
+	if parent == nil {
+		return fn()
+	}
+
+	index := childIndex(parent, path.End())
+	if index < 0 {
+		return fn()
+	}
+
+	op := operation{
+		kind:  opRemove,
+		path:  copyPath(path),
+		index: index,
+	}
+
+	value := parent.Content[index]
+	if parent.Kind == yaml.MappingNode {
+		op.key = value
+		value = parent.Content[index+1]
+	}
+
+	// The removed nodes are detached from the tree and not cloned.
+	op.oldValue = value
+
+	err := d.run(fn)
+
+	if index >= len(parent.Content) || (parent.Content[index] != op.key && parent.Content[index] != value) {
+		if vetoErr := d.commit([]operation{op}); vetoErr != nil {
+			return vetoErr
+		}
+	}
+
+	return err
+}
+
+// run calls fn, whose changes are recorded as a whole, so that the
+// comment setters used by fn do not record them again.
+func (d *document) run(fn func() error) error {
+	d.changing++
+	defer func() { d.changing-- }()
+
+	return fn()
+}
+
+func (d *document) setComment(field CommentPosition, comment string) {
+	target := commentTarget(d.node, field)
+	if !d.recording() || *target == comment {
+		*target = comment
+		return
+	}
+
+	op := operation{
+		kind:       opComment,
+		comment:    field,
+		oldComment: *target,
+		newComment: comment,
+	}
+
+	*target = comment
+
+	// the comment setters cannot return errors, so a veto is
+	// silently reverted
+	_ = d.commit([]operation{op})
+}
+
+// setNodeComment changes a comment of a node in the document.
+func (d *document) setNodeComment(target *yaml.Node, field CommentPosition, comment string) {
+	current := commentTarget(target, field)
+	if !d.recording() || d.changing > 0 || *current == comment {
+		*current = comment
+		return
+	}
+
+	path, owner, found := d.locate(target)
+	if !found {
+		*current = comment
+		return
+	}
+
+	op := operation{
+		kind:       opComment,
+		path:       path,
+		owner:      owner,
+		comment:    field,
+		oldComment: *current,
+		newComment: comment,
+	}
+
+	*current = comment
+
+	// the comment setters cannot return errors, so a veto is
+	// silently reverted
+	_ = d.commit([]operation{op})
+}
+
+// stripNodeComments removes all comments from a node of the document
+// and its children, recording each removed comment separately.
+func (d *document) stripNodeComments(target *yaml.Node) {
+	if !d.recording() || d.changing > 0 {
+		stripComments(target)
+		return
+	}
+
+	path, owner, found := d.locate(target)
+	if !found {
+		stripComments(target)
+		return
+	}
+
+	// comments in complex keys and below duplicate keys cannot be
+	// addressed by a path
+	if !addressable(target) {
+		scope := path
+		if owner == commentOnKey {
+			scope = path.Parent()
+		}
+
+		_ = d.mutate(scope, func() error {
+			stripComments(target)
+			return nil
+		})
+
+		return
+	}
+
+	var ops []operation
+
+	var walk func(n *yaml.Node, path Path, owner commentOwner)
+	walk = func(n *yaml.Node, path Path, owner commentOwner) {
+		for _, field := range []CommentPosition{CommentHead, CommentLine, CommentFoot} {
+			current := commentTarget(n, field)
+
+			// blank lines are kept
+			comment := ""
+			if field == CommentHead {
+				comment = withBlankLines("", blankLines(*current))
+			}
+
+			if *current != comment {
+				ops = append(ops, operation{
+					kind:       opComment,
+					path:       copyPath(path),
+					owner:      owner,
+					comment:    field,
+					oldComment: *current,
+					newComment: comment,
+				})
+
+				*current = comment
+			}
+		}
+
+		if owner == commentOnKey {
+			return
+		}
+
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				childPath := append(copyPath(path), keyStep(n.Content[i]))
+
+				walk(n.Content[i], childPath, commentOnKey)
+				walk(n.Content[i+1], childPath, commentOnNode)
+			}
+
+		case yaml.SequenceNode:
+			for i, item := range n.Content {
+				walk(item, append(copyPath(path), i), commentOnNode)
+			}
+		}
+	}
+
+	walk(target, path, owner)
+
+	_ = d.commit(ops)
+}
+
+// addressable returns true if all keys in the node and its children
+// are scalars and unique, so that each node can be reached by a path.
+func addressable(n *yaml.Node) bool {
+	if n.Kind == yaml.MappingNode {
+		seen := make(map[string]bool, len(n.Content)/2)
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Kind != yaml.ScalarNode || seen[key.Value] {
+				return false
+			}
+
+			seen[key.Value] = true
+		}
+	}
+
+	for _, child := range n.Content {
+		if !addressable(child) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// changeNode runs fn, which changes the node and its children, and
+// records the change as a replacement of the node.
+func (d *document) changeNode(target *yaml.Node, fn func() error) error {
+	if !d.recording() || d.changing > 0 {
+		return fn()
+	}
+
+	path, owner, found := d.locate(target)
+	if !found {
+		return fn()
+	}
+
+	if owner == commentOnKey {
+		path = path.Parent()
+	}
+
+	return d.mutate(path, fn)
+}
+
+// nodeChange selects how changeNodeAt() records a change.
+type nodeChange int
+
+const (
+	// changeInPlace records the change like mutate().
+	changeInPlace nodeChange = iota
+	// changeReplacing records the change like replace().
+	changeReplacing
+	// changeRemoving records the change like mutateDelete().
+	changeRemoving
+)
+
+// changeNodeAt runs fn, which changes the document at the path relative
+// to the target node, like the Document API does: protected nodes are
+// checked, and the change is seen by observers and recorded.
+func (d *document) changeNodeAt(target *yaml.Node, path Path, mode nodeChange, fn func() error) error {
+	if !d.recording() || d.changing > 0 {
+		return fn()
+	}
+
+	// the mutate functions call fn directly in some cases, but changes
+	// made by fn must never be recorded again
+	run := func() error {
+		return d.run(fn)
+	}
+
+	located, owner, found := d.locate(target)
+	if !found || owner == commentOnKey {
+		// below duplicate keys, the node cannot be addressed by a path;
+		// a node that is not part of the document cannot change it
+		return d.mutate(nil, run)
+	}
+
+	path = append(located, path...)
+
+	switch mode {
+	case changeReplacing:
+		return d.replace(path, run)
+	case changeRemoving:
+		return d.mutateDelete(path, run)
+	default:
+		return d.mutate(path, run)
+	}
+}
+
+// locate returns the path to a node of the document and whether it is
+// the key of the entry at that path.
+func (d *document) locate(target *yaml.Node) (Path, commentOwner, bool) {
+	var path Path
+
+	owner := commentOnNode
+
+	var walk func(n *yaml.Node) bool
+	walk = func(n *yaml.Node) bool {
+		if n == target {
+			return true
+		}
+
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				path = append(path, keyStep(n.Content[i]))
+
+				if n.Content[i] == target {
+					owner = commentOnKey
+					return true
+				}
+
+				if walk(n.Content[i+1]) {
+					return true
+				}
+
+				path = path[:len(path)-1]
+			}
+
+		case yaml.SequenceNode:
+			for i, item := range n.Content {
+				path = append(path, i)
+
+				if walk(item) {
+					return true
+				}
+
+				path = path[:len(path)-1]
+			}
+		}
+
+		return false
+	}
+
+	if !walk(d.node.Content[0]) {
+		return nil, owner, false
+	}
+
+	// below duplicate keys, the path can lead to another node
+	if d.commentNode(path, owner) != target {
+		return nil, owner, false
+	}
+
+	return copyPath(path), owner, true
+}
+
+// commentNode returns the node whose comment is changed by an
+// opComment.
+func (d *document) commentNode(path Path, owner commentOwner) *yaml.Node {
+	switch owner {
+	case commentOnDocument:
+		return d.node
+
+	case commentOnKey:
+		if len(path) == 0 {
+			return nil
+		}
+
+		parent := lookupPath(d.node.Content[0], path.Parent())
+		if parent == nil {
+			return nil
+		}
+
+		key, _ := childNodes(parent, path.End())
+
+		return key
+
+	default:
+		return lookupPath(d.node.Content[0], path)
+	}
+}
+
+// pendingChange holds the state of the document before a change was
+// made to a given path.
+type pendingChange struct {
+	path Path
+	// existing is the number of steps of the path that exist.
+	existing int
+	// parent is the node at path[:existing].
+	parent *yaml.Node
+	// length is the length of the parent's content.
+	length int
+	// replaced is a copy of the parent if it is going to be replaced.
+	replaced *yaml.Node
+}
+
+func (d *document) prepareChange(path Path, replacing bool) *pendingChange {
+	change := &pendingChange{
+		path:   copyPath(path),
+		parent: d.node.Content[0],
+	}
+
+	// below a duplicate key, paths are ambiguous and the mapping
+	// containing it is replaced as a whole
+	duplicate := d.firstDuplicate(path)
+
+	for i, step := range path {
+		if i == duplicate {
+			break
+		}
+
+		index := childIndex(change.parent, step)
+		if index < 0 {
+			break
+		}
+
+		change.parent = childAt(change.parent, index)
+		change.existing++
+	}
+
+	change.length = len(change.parent.Content)
+
+	switch {
+	case replacing && duplicate < 0 && change.existing == len(path):
+		// the node is swapped out and stays unchanged
+		replaced := *change.parent
+		change.replaced = &replaced
+
+	case duplicate >= 0 || change.existing == len(path) || !canContain(change.parent, path[change.existing]):
+		change.replaced = cloneNode(change.parent)
+	}
+
+	return change
+}
+
+func (c *pendingChange) operations(d *document) []operation {
+	// the node at the (partial) path was changed in-place
+	if c.replaced != nil {
+		path := c.path[:c.existing]
+
+		current := lookupPath(d.node.Content[0], path)
+		if current == nil || Equal(&node{node: c.replaced}, &node{node: current}, EqualOptions{}) {
+			return nil
+		}
+
+		return []operation{{
+			kind:     opReplace,
+			path:     path,
+			oldValue: c.replaced,
+			newValue: cloneNode(current),
+		}}
+	}
+
+	// new items were added to the parent
+	parentPath := c.path[:c.existing]
+	step := c.path[c.existing]
+
+	switch c.parent.Kind {
+	case yaml.MappingNode:
+		index := childIndex(c.parent, step)
+		if index < 0 {
+			return nil
+		}
+
+		return []operation{{
+			kind:     opInsert,
+			path:     append(copyPath(parentPath), step),
+			index:    index,
+			key:      cloneNode(c.parent.Content[index]),
+			newValue: cloneNode(c.parent.Content[index+1]),
+		}}
+
+	case yaml.SequenceNode:
+		var ops []operation
+
+		for i := c.length; i < len(c.parent.Content); i++ {
+			ops = append(ops, operation{
+				kind:     opInsert,
+				path:     append(copyPath(parentPath), i),
+				index:    i,
+				newValue: cloneNode(c.parent.Content[i]),
+			})
+		}
+
+		return ops
+	}
+
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// applying operations
+
+// apply performs the operation on the document, or reverts it if
+// reverse is true.
+func (d *document) apply(op operation, reverse bool) error {
+	// operations can replace or move entire subtrees
+	d.tree.keyIndex().reset()
+
+	switch op.kind {
+	case opReplace:
+		target := lookupPath(d.node.Content[0], op.path)
+		if target == nil {
+			return errors.New("node does not exist")
+		}
+
+		value := op.newValue
+		if reverse {
+			value = op.oldValue
+		}
+
+		shallowCopyNode(target, *cloneNode(value))
+
+		return nil
+
+	case opInsert, opRemove:
+		parent := lookupPath(d.node.Content[0], op.path.Parent())
+		if parent == nil {
+			return errors.New("parent node does not exist")
+		}
+
+		if (op.kind == opInsert) != reverse {
+			value := op.newValue
+			if reverse {
+				value = op.oldValue
+			}
+
+			return insertChild(parent, op.index, op.key, value)
+		}
+
+		return removeChild(parent, op.index)
+
+	case opComment:
+		target := d.commentNode(op.path, op.owner)
+		if target == nil {
+			return errors.New("node does not exist")
+		}
+
+		comment := op.newComment
+		if reverse {
+			comment = op.oldComment
+		}
+
+		*commentTarget(target, op.comment) = comment
+
+		return nil
+
+	default:
+		return fmt.Errorf("unknown operation %v", op.kind)
+	}
+}
+
+func insertChild(parent *yaml.Node, index int, key *yaml.Node, value *yaml.Node) error {
+	items := []*yaml.Node{cloneNode(value)}
+	if parent.Kind == yaml.MappingNode {
+		if key == nil {
+			return errors.New("mapping items require a key")
+		}
+
+		items = []*yaml.Node{cloneNode(key), items[0]}
+	}
+
+	if index > len(parent.Content) {
+		return errors.New("index out of range")
+	}
+
+	content := make([]*yaml.Node, 0, len(parent.Content)+len(items))
+	content = append(content, parent.Content[:index]...)
+	content = append(content, items...)
+	content = append(content, parent.Content[index:]...)
+	parent.Content = content
+
+	return nil
+}
+
+func removeChild(parent *yaml.Node, index int) error {
+	size := 1
+	if parent.Kind == yaml.MappingNode {
+		size = 2
+	}
+
+	if index+size > len(parent.Content) {
+		return errors.New("index out of range")
+	}
+
+	parent.Content = append(parent.Content[:index], parent.Content[index+size:]...)
+
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// helpers
+
+// childIndex returns the position of the child for the given step in
+// the node's Content (for mappings, the position of the key node), or
+// -1 if there is no such child.
+func childIndex(n *yaml.Node, step Step) int {
+	switch s := step.(type) {
+	case string:
+		if n.Kind != yaml.MappingNode {
+			return -1
+		}
+
+		return findKey(n, s, nil)
+
+	case KeyStep:
+		if n.Kind != yaml.MappingNode {
+			return -1
+		}
+
+		if positions := s.positions(n, nil); len(positions) > 0 {
+			return positions[0]
+		}
+
+		return -1
+
+	case int:
+		if n.Kind != yaml.SequenceNode {
+			return -1
+		}
+
+		s = sequenceIndex(n, s)
+		if s < 0 || s >= len(n.Content) {
+			return -1
+		}
+
+		return s
+
+	case MatchStep:
+		return s.index(n)
+
+	default:
+		return -1
+	}
+}
+
+// childAt returns the value at the given position in the node's
+// Content, as returned by childIndex.
+func childAt(n *yaml.Node, index int) *yaml.Node {
+	if n.Kind == yaml.MappingNode {
+		return n.Content[index+1]
+	}
+
+	return n.Content[index]
+}
+
+// canContain returns true if the node can have a child for the given
+// step without having to change its kind.
+func canContain(n *yaml.Node, step Step) bool {
+	switch step.(type) {
+	case string, KeyStep:
+		return n.Kind == yaml.MappingNode
+	case int, AppendStep, MatchStep:
+		return n.Kind == yaml.SequenceNode
+	default:
+		return false
+	}
+}
+
+// concretePath replaces negative indexes, End and MatchSteps with the
+// positions they refer to in the current document, so that recorded
+// operations can be replayed later.
+func (d *document) concretePath(path Path) Path {
+	result := copyPath(path)
+	current := d.node.Content[0]
+
+	for i, step := range result {
+		isSequence := current != nil && current.Kind == yaml.SequenceNode
+
+		switch s := step.(type) {
+		case int:
+			if isSequence && s < 0 && sequenceIndex(current, s) >= 0 {
+				result[i] = sequenceIndex(current, s)
+			}
+
+		case AppendStep:
+			// a missing sequence will be created empty
+			result[i] = 0
+			if isSequence {
+				result[i] = len(current.Content)
+			}
+
+		case MatchStep:
+			// items that do not match yet are appended, if at all
+			switch {
+			case !isSequence:
+				result[i] = 0
+			case s.index(current) >= 0:
+				result[i] = s.index(current)
+			default:
+				result[i] = len(current.Content)
+			}
+		}
+
+		if current != nil {
+			if index := childIndex(current, result[i]); index >= 0 {
+				current = childAt(current, index)
+			} else {
+				current = nil
+			}
+		}
+	}
+
+	return result
+}
+
+// lookupPath returns the node at the given path or nil.
+func lookupPath(n *yaml.Node, path Path) *yaml.Node {
+	for _, step := range path {
+		index := childIndex(n, step)
+		if index < 0 {
+			return nil
+		}
+
+		n = childAt(n, index)
+	}
+
+	return n
+}
+
+func commentTarget(n *yaml.Node, field CommentPosition) *string {
+	switch field {
+	case CommentLine:
+		return &n.LineComment
+	case CommentFoot:
+		return &n.FootComment
+	default:
+		return &n.HeadComment
+	}
+}
+
+func copyPath(p Path) Path {
+	return append(Path{}, p...)
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"strings"
+)
+
+// GroupVersionKind identifies the type of a Kubernetes object. The
+// core API group is represented by an empty Group.
+type GroupVersionKind struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+// ParseGroupVersionKind splits an apiVersion (e.g. "apps/v1" or "v1")
+// and combines it with the given kind.
+func ParseGroupVersionKind(apiVersion string, kind string) GroupVersionKind {
+	gvk := GroupVersionKind{
+		Kind: kind,
+	}
+
+	if group, version, found := strings.Cut(apiVersion, "/"); found {
+		gvk.Group = group
+		gvk.Version = version
+	} else {
+		gvk.Version = apiVersion
+	}
+
+	return gvk
+}
+
+// APIVersion returns the apiVersion as it would be written into a manifest.
+func (gvk GroupVersionKind) APIVersion() string {
+	if gvk.Group == "" {
+		return gvk.Version
+	}
+
+	return gvk.Group + "/" + gvk.Version
+}
+
+func (gvk GroupVersionKind) String() string {
+	return gvk.APIVersion() + ", Kind=" + gvk.Kind
+}
+
+// ObjectKey uniquely identifies an object in a manifest. Cluster-scoped
+// objects have an empty Namespace.
+type ObjectKey struct {
+	GroupVersionKind
+
+	Namespace string
+	Name      string
+}
+
+func (k ObjectKey) String() string {
+	name := k.Name
+	if k.Namespace != "" {
+		name = k.Namespace + "/" + name
+	}
+
+	return k.GroupVersionKind.String() + " " + name
+}
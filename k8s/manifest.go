@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a stream of YAML documents, each representing a single
+// Kubernetes object. Objects are indexed by their apiVersion, kind,
+// namespace and name.
+type Manifest struct {
+	objects []*Object
+	index   map[ObjectKey]*Object
+}
+
+// LoadManifest decodes all documents from the given reader.
+func LoadManifest(r io.Reader) (*Manifest, error) {
+	decoder := yaml.NewDecoder(r)
+	m := &Manifest{}
+
+	for {
+		var node yaml.Node
+
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML in document %d: %w", len(m.objects)+1, err)
+		}
+
+		obj, err := NewObject(&node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document %d: %w", len(m.objects)+1, err)
+		}
+
+		m.objects = append(m.objects, obj)
+	}
+
+	m.Reindex()
+
+	return m, nil
+}
+
+// Objects returns all objects, including empty documents, in the
+// order they appear in the manifest.
+func (m *Manifest) Objects() []*Object {
+	return m.objects
+}
+
+// Append adds a new object to the end of the manifest.
+func (m *Manifest) Append(obj *Object) {
+	m.objects = append(m.objects, obj)
+	m.indexObject(obj)
+}
+
+// Remove removes the given object from the manifest.
+func (m *Manifest) Remove(obj *Object) bool {
+	for i, o := range m.objects {
+		if o == obj {
+			m.objects = append(m.objects[:i], m.objects[i+1:]...)
+			m.Reindex()
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reindex rebuilds the object index. This is done automatically when
+// objects cannot be found, but can be used after many objects have
+// been renamed.
+func (m *Manifest) Reindex() {
+	m.index = map[ObjectKey]*Object{}
+
+	for _, obj := range m.objects {
+		m.indexObject(obj)
+	}
+}
+
+func (m *Manifest) indexObject(obj *Object) {
+	if m.index == nil {
+		m.index = map[ObjectKey]*Object{}
+	}
+
+	if obj.IsEmpty() {
+		return
+	}
+
+	// like kubectl, the first occurrence of an object wins
+	key := obj.Key()
+	if _, exists := m.index[key]; !exists {
+		m.index[key] = obj
+	}
+}
+
+// FindObject returns the object with the given type, namespace and
+// name. Use an empty namespace for cluster-scoped objects.
+func (m *Manifest) FindObject(gvk GroupVersionKind, namespace string, name string) (*Object, bool) {
+	key := ObjectKey{
+		GroupVersionKind: gvk,
+		Namespace:        namespace,
+		Name:             name,
+	}
+
+	if obj, ok := m.lookup(key); ok {
+		return obj, true
+	}
+
+	// objects might have been edited since the index was built
+	m.Reindex()
+
+	return m.lookup(key)
+}
+
+func (m *Manifest) lookup(key ObjectKey) (*Object, bool) {
+	obj, ok := m.index[key]
+	if !ok || obj.Key() != key {
+		return nil, false
+	}
+
+	return obj, true
+}
+
+// Filter returns all non-empty objects of the given kind, regardless
+// of their API group and version.
+func (m *Manifest) Filter(kind string) []*Object {
+	var result []*Object
+
+	for _, obj := range m.objects {
+		if !obj.IsEmpty() && obj.Kind() == kind {
+			result = append(result, obj)
+		}
+	}
+
+	return result
+}
+
+// Bytes encodes all documents, separated by "---".
+func (m *Manifest) Bytes(indent int) ([]byte, error) {
+	// the encoder cannot be closed without having encoded anything
+	if len(m.objects) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+
+	if err := m.Encode(encoder); err != nil {
+		return nil, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (m *Manifest) Encode(encoder *yaml.Encoder) error {
+	for i, obj := range m.objects {
+		if err := obj.Document().Encode(encoder); err != nil {
+			return fmt.Errorf("failed to encode document %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
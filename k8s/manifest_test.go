@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"go.xrstf.de/yamled"
+)
+
+const testManifest = `
+# the namespace
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: prod
+data:
+  key: value
+---
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: config
+  namespace: prod
+`
+
+func TestLoadManifest(t *testing.T) {
+	manifest, err := LoadManifest(strings.NewReader(strings.TrimSpace(testManifest)))
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	if objects := manifest.Objects(); len(objects) != 4 {
+		t.Fatalf("Expected 4 documents, but got %d.", len(objects))
+	}
+
+	if !manifest.Objects()[2].IsEmpty() {
+		t.Fatal("Expected third document to be empty.")
+	}
+
+	if deployments := manifest.Filter("Deployment"); len(deployments) != 1 {
+		t.Fatalf("Expected 1 Deployment, but got %d.", len(deployments))
+	}
+}
+
+func TestManifestFindObject(t *testing.T) {
+	manifest, err := LoadManifest(strings.NewReader(strings.TrimSpace(testManifest)))
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	configMapGVK := GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	obj, ok := manifest.FindObject(configMapGVK, "prod", "config")
+	if !ok {
+		t.Fatal("Expected to find ConfigMap, but did not.")
+	}
+
+	if value := obj.Document().MustGet("data", "key").ToString(); value != "value" {
+		t.Fatalf("Found the wrong object, expected data.key to be \"value\", but got %q.", value)
+	}
+
+	if _, ok := manifest.FindObject(configMapGVK, "", "config"); ok {
+		t.Fatal("Should not have found ConfigMap in the wrong namespace.")
+	}
+
+	if _, ok := manifest.FindObject(GroupVersionKind{Version: "v1", Kind: "Namespace"}, "", "prod"); !ok {
+		t.Fatal("Expected to find cluster-scoped Namespace, but did not.")
+	}
+
+	// renaming should not break lookups
+	if err := obj.SetName("renamed"); err != nil {
+		t.Fatalf("Failed to rename object: %v", err)
+	}
+
+	if _, ok := manifest.FindObject(configMapGVK, "prod", "renamed"); !ok {
+		t.Fatal("Expected to find renamed ConfigMap, but did not.")
+	}
+
+	if _, ok := manifest.FindObject(configMapGVK, "prod", "config"); ok {
+		t.Fatal("Should not have found ConfigMap under its old name.")
+	}
+}
+
+func TestManifestBytes(t *testing.T) {
+	manifest, err := LoadManifest(strings.NewReader(strings.TrimSpace(testManifest)))
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	obj := manifest.Filter("ConfigMap")[0]
+	if _, err := obj.Document().SetAt(yamled.Path{"data", "key"}, "changed"); err != nil {
+		t.Fatalf("Failed to change value: %v", err)
+	}
+
+	encoded, err := manifest.Bytes(2)
+	if err != nil {
+		t.Fatalf("Failed to encode manifest: %v", err)
+	}
+
+	expected := strings.TrimSpace(`
+# the namespace
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: prod
+data:
+  key: changed
+---
+
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: config
+  namespace: prod
+`)
+
+	if got := strings.TrimSpace(string(encoded)); got != expected {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expected, got)
+	}
+}
+
+func TestEmptyManifestBytes(t *testing.T) {
+	for _, input := range []string{"", "# just a comment\n"} {
+		manifest, err := LoadManifest(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Failed to load manifest: %v", err)
+		}
+
+		encoded, err := manifest.Bytes(2)
+		if err != nil {
+			t.Fatalf("Failed to encode manifest %q: %v", input, err)
+		}
+
+		if len(encoded) > 0 {
+			t.Errorf("Expected no output for %q, but got %q.", input, string(encoded))
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.xrstf.de/yamled"
+	"gopkg.in/yaml.v3"
+)
+
+// Object is a single Kubernetes object, i.e. one document in a
+// (possibly multi-document) manifest.
+type Object struct {
+	node *yaml.Node
+	doc  yamled.Document
+}
+
+// NewObject wraps a yaml.v3 document node. The node is not
+// checked for containing a valid Kubernetes object, so that even
+// empty documents in a stream can be represented.
+func NewObject(node *yaml.Node) (*Object, error) {
+	doc, err := yamled.NewDocument(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		node: node,
+		doc:  doc,
+	}, nil
+}
+
+// Document returns the underlying yamled document, which can be
+// used to perform arbitrary edits.
+func (o *Object) Document() yamled.Document {
+	return o.doc
+}
+
+// IsEmpty returns true if the document does not contain a mapping,
+// like a stray "---" in a manifest.
+func (o *Object) IsEmpty() bool {
+	root, err := o.doc.RootNode()
+	if err != nil {
+		return true
+	}
+
+	return root.Kind() != yaml.MappingNode
+}
+
+func (o *Object) APIVersion() string {
+	return o.doc.MustGet("apiVersion").ToString()
+}
+
+func (o *Object) Kind() string {
+	return o.doc.MustGet("kind").ToString()
+}
+
+func (o *Object) GroupVersionKind() GroupVersionKind {
+	return ParseGroupVersionKind(o.APIVersion(), o.Kind())
+}
+
+func (o *Object) Namespace() string {
+	return o.doc.MustGet("metadata", "namespace").ToString()
+}
+
+func (o *Object) SetNamespace(namespace string) error {
+	_, err := o.doc.SetAt(yamled.Path{"metadata", "namespace"}, namespace)
+	return err
+}
+
+func (o *Object) Name() string {
+	return o.doc.MustGet("metadata", "name").ToString()
+}
+
+func (o *Object) SetName(name string) error {
+	_, err := o.doc.SetAt(yamled.Path{"metadata", "name"}, name)
+	return err
+}
+
+func (o *Object) Key() ObjectKey {
+	return ObjectKey{
+		GroupVersionKind: o.GroupVersionKind(),
+		Namespace:        o.Namespace(),
+		Name:             o.Name(),
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// labels & annotations
+
+func (o *Object) Labels() map[string]string {
+	return o.stringMap("metadata", "labels")
+}
+
+func (o *Object) Label(key string) (string, bool) {
+	return o.stringValue("metadata", "labels", key)
+}
+
+func (o *Object) SetLabel(key string, value string) error {
+	_, err := o.doc.SetAt(yamled.Path{"metadata", "labels", key}, value)
+	return err
+}
+
+func (o *Object) DeleteLabel(key string) error {
+	return o.doc.DeleteKey("metadata", "labels", key)
+}
+
+func (o *Object) Annotations() map[string]string {
+	return o.stringMap("metadata", "annotations")
+}
+
+func (o *Object) Annotation(key string) (string, bool) {
+	return o.stringValue("metadata", "annotations", key)
+}
+
+func (o *Object) SetAnnotation(key string, value string) error {
+	_, err := o.doc.SetAt(yamled.Path{"metadata", "annotations", key}, value)
+	return err
+}
+
+func (o *Object) DeleteAnnotation(key string) error {
+	return o.doc.DeleteKey("metadata", "annotations", key)
+}
+
+func (o *Object) stringMap(steps ...yamled.Step) map[string]string {
+	node, ok := o.doc.Get(steps...)
+	if !ok {
+		return nil
+	}
+
+	result := map[string]string{}
+	for key := range node.ToMap() {
+		result[key] = node.MustGet(key).ToString()
+	}
+
+	return result
+}
+
+func (o *Object) stringValue(steps ...yamled.Step) (string, bool) {
+	node, ok := o.doc.Get(steps...)
+	if !ok {
+		return "", false
+	}
+
+	return node.ToString(), true
+}
+
+/////////////////////////////////////////////////////////////////////
+// containers
+
+// Container is a reference to a single container in a pod spec.
+type Container struct {
+	// Path is the full path to the container's node in the document.
+	Path  yamled.Path
+	Name  string
+	Image string
+	// Init is true for initContainers.
+	Init bool
+}
+
+// podSpecPaths maps well-known workload kinds to the location of
+// their pod spec.
+var podSpecPaths = map[string]yamled.Path{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// PodSpecPath returns the path to the pod spec for workload objects.
+func (o *Object) PodSpecPath() (yamled.Path, bool) {
+	path, ok := podSpecPaths[o.Kind()]
+	if !ok {
+		return nil, false
+	}
+
+	return append(yamled.Path{}, path...), true
+}
+
+// Containers returns all init containers and containers (in this order)
+// in the object's pod spec. Non-workload objects have no containers.
+func (o *Object) Containers() []Container {
+	specPath, ok := o.PodSpecPath()
+	if !ok {
+		return nil
+	}
+
+	var containers []Container
+
+	for _, field := range []string{"initContainers", "containers"} {
+		listPath := specPath.Append(field)
+
+		list, ok := o.doc.Get(listPath...)
+		if !ok || list.Kind() != yaml.SequenceNode {
+			continue
+		}
+
+		for i := range list.ToSlice() {
+			item := list.MustGet(i)
+
+			containers = append(containers, Container{
+				Path:  append(yamled.Path{}, listPath.Append(i)...),
+				Name:  item.MustGet("name").ToString(),
+				Image: item.MustGet("image").ToString(),
+				Init:  field == "initContainers",
+			})
+		}
+	}
+
+	return containers
+}
+
+// Container returns the (init) container with the given name.
+func (o *Object) Container(name string) (Container, bool) {
+	for _, c := range o.Containers() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return Container{}, false
+}
+
+// Images returns the sorted, de-duplicated list of all images used
+// in the object.
+func (o *Object) Images() []string {
+	images := map[string]struct{}{}
+	for _, c := range o.Containers() {
+		if c.Image != "" {
+			images[c.Image] = struct{}{}
+		}
+	}
+
+	result := make([]string, 0, len(images))
+	for image := range images {
+		result = append(result, image)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// SetImage updates the image of the (init) container with the given name.
+func (o *Object) SetImage(container string, image string) error {
+	c, ok := o.Container(container)
+	if !ok {
+		return fmt.Errorf("no container named %q found", container)
+	}
+
+	_, err := o.doc.SetAt(c.Path.Append("image"), image)
+	return err
+}
+
+// ReplaceImage changes all containers using oldImage to use newImage
+// instead and returns the number of changed containers.
+func (o *Object) ReplaceImage(oldImage string, newImage string) (int, error) {
+	if oldImage == "" {
+		return 0, errors.New("old image must not be empty")
+	}
+
+	changed := 0
+	for _, c := range o.Containers() {
+		if c.Image != oldImage {
+			continue
+		}
+
+		if _, err := o.doc.SetAt(c.Path.Append("image"), newImage); err != nil {
+			return changed, err
+		}
+
+		changed++
+	}
+
+	return changed, nil
+}
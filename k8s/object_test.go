@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func loadObject(t *testing.T, input string) (*yaml.Node, *Object) {
+	var node yaml.Node
+	if err := yaml.NewDecoder(strings.NewReader(strings.TrimSpace(input))).Decode(&node); err != nil {
+		t.Fatalf("Failed to decode YAML: %v", err)
+	}
+
+	obj, err := NewObject(&node)
+	if err != nil {
+		t.Fatalf("Failed to create object: %v", err)
+	}
+
+	return &node, obj
+}
+
+func expectYAML(t *testing.T, v interface{}, expectedYAML string) {
+	var buf strings.Builder
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(v); err != nil {
+		t.Fatalf("Failed to encode data structure as YAML: %v", err)
+	}
+
+	encoded := strings.TrimSpace(buf.String())
+	expectedYAML = strings.TrimSpace(expectedYAML)
+
+	if encoded != expectedYAML {
+		t.Fatalf("Expected\n---\n%s\n---\n\nbut got\n\n---\n%s\n---", expectedYAML, encoded)
+	}
+}
+
+const testDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+  # managed by the platform team
+  labels:
+    app: web # do not change
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: migrate:1.0
+      containers:
+        # the main application
+        - name: web
+          image: nginx:1.25 # pinned
+        - name: sidecar
+          image: envoy:1.0
+`
+
+func TestObjectMetadata(t *testing.T) {
+	_, obj := loadObject(t, testDeployment)
+
+	key := obj.Key()
+	expected := ObjectKey{
+		GroupVersionKind: GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Namespace:        "prod",
+		Name:             "web",
+	}
+
+	if key != expected {
+		t.Fatalf("Expected key %v, but got %v.", expected, key)
+	}
+
+	if value, ok := obj.Label("app"); !ok || value != "web" {
+		t.Fatalf("Expected app label to be \"web\", but got %q.", value)
+	}
+
+	if labels := obj.Labels(); len(labels) != 1 {
+		t.Fatalf("Expected 1 label, but got %v.", labels)
+	}
+
+	if annotations := obj.Annotations(); annotations != nil {
+		t.Fatalf("Expected no annotations, but got %v.", annotations)
+	}
+}
+
+func TestObjectSetLabelsAndAnnotations(t *testing.T) {
+	node, obj := loadObject(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  # managed by the platform team
+  labels:
+    app: web # do not change
+`)
+
+	if err := obj.SetLabel("tier", "frontend"); err != nil {
+		t.Fatalf("Failed to set label: %v", err)
+	}
+
+	if err := obj.SetAnnotation("example.com/owner", "team-a"); err != nil {
+		t.Fatalf("Failed to set annotation: %v", err)
+	}
+
+	expectYAML(t, node, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  # managed by the platform team
+  labels:
+    app: web # do not change
+    tier: frontend
+  annotations:
+    example.com/owner: team-a
+`)
+
+	if err := obj.DeleteLabel("tier"); err != nil {
+		t.Fatalf("Failed to delete label: %v", err)
+	}
+
+	if labels := obj.Labels(); len(labels) != 1 {
+		t.Fatalf("Expected 1 label after deleting, but got %v.", labels)
+	}
+}
+
+func TestObjectContainers(t *testing.T) {
+	_, obj := loadObject(t, testDeployment)
+
+	containers := obj.Containers()
+	if len(containers) != 3 {
+		t.Fatalf("Expected 3 containers, but got %d.", len(containers))
+	}
+
+	if !containers[0].Init || containers[0].Name != "migrate" {
+		t.Fatalf("Expected first container to be the init container, but got %+v.", containers[0])
+	}
+
+	images := obj.Images()
+	if strings.Join(images, ",") != "envoy:1.0,migrate:1.0,nginx:1.25" {
+		t.Fatalf("Unexpected images: %v", images)
+	}
+}
+
+func TestObjectSetImage(t *testing.T) {
+	node, obj := loadObject(t, testDeployment)
+
+	if err := obj.SetImage("web", "nginx:1.26"); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+
+	if err := obj.SetImage("nonexisting", "nginx:1.26"); err == nil {
+		t.Fatal("Should not have been able to set image of unknown container.")
+	}
+
+	expectYAML(t, node, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+  # managed by the platform team
+  labels:
+    app: web # do not change
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: migrate:1.0
+      containers:
+        # the main application
+        - name: web
+          image: nginx:1.26
+        - name: sidecar
+          image: envoy:1.0
+`)
+}
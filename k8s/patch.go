@@ -0,0 +1,477 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	patchDirective                = "$patch"
+	retainKeysDirective           = "$retainKeys"
+	setElementOrderPrefix         = "$setElementOrder/"
+	deleteFromPrimitiveListPrefix = "$deleteFromPrimitiveList/"
+)
+
+// StrategicMergePatch applies a Kubernetes strategic merge patch to
+// the object, using the built-in patch metadata for the object's kind.
+// The patch is applied through the object's Document, so it is part of
+// its history and transactions.
+func (o *Object) StrategicMergePatch(patch interface{}) error {
+	gvk := o.GroupVersionKind()
+
+	return o.doc.Edit(nil, func(root *yaml.Node) error {
+		return StrategicMergePatch(root, patch, gvk)
+	})
+}
+
+// StrategicMergePatch applies a strategic merge patch to the given
+// document or mapping node. The patch can be anything that can be
+// marshalled into a YAML mapping, including yaml.Node and yamled.Node.
+// Lists in well-known core/apps types (like containers or env) are
+// merged by their patch merge key, all other lists are replaced.
+// The target is modified in-place, so that comments on all nodes
+// not removed by the patch are preserved.
+// The directives $patch (replace, delete, merge), $retainKeys,
+// $setElementOrder and $deleteFromPrimitiveList are supported.
+func StrategicMergePatch(target *yaml.Node, patch interface{}, gvk GroupVersionKind) error {
+	if target == nil {
+		return errors.New("target cannot be nil")
+	}
+
+	if target.Kind == yaml.DocumentNode {
+		if len(target.Content) == 0 {
+			return errors.New("target document is empty")
+		}
+
+		target = target.Content[0]
+	}
+
+	if target.Kind != yaml.MappingNode {
+		return errors.New("target must be a mapping")
+	}
+
+	patchNode, err := toPatchNode(patch)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := mergeMapping(target, patchNode, lookupPatchMeta(gvk))
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		return errors.New("patch cannot delete the entire object")
+	}
+
+	return nil
+}
+
+func toPatchNode(patch interface{}) (*yaml.Node, error) {
+	// always work on a copy of the patch, so that nodes can
+	// be moved into the target without aliasing the patch
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(patch); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	var node yaml.Node
+	if err := yaml.NewDecoder(&buf).Decode(&node); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	if node.Kind != yaml.DocumentNode || len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("patch must be a mapping")
+	}
+
+	return node.Content[0], nil
+}
+
+// mergeMapping merges the patch into the target mapping and returns
+// true if the patch requested the target to be deleted.
+func mergeMapping(target *yaml.Node, patch *yaml.Node, meta *patchMeta) (bool, error) {
+	switch directive := scalarValue(patch, patchDirective); directive {
+	case "delete":
+		return true, nil
+
+	case "replace":
+		target.Content = cleanPatch(patch).Content
+		return false, nil
+
+	case "", "merge":
+		// continue below
+
+	default:
+		return false, fmt.Errorf("unknown %s directive %q", patchDirective, directive)
+	}
+
+	var (
+		retainKeys *yaml.Node
+		orders     = map[string]*yaml.Node{}
+		deletions  = map[string]*yaml.Node{}
+		fields     []string
+	)
+
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		keyNode := patch.Content[i]
+		valueNode := patch.Content[i+1]
+		key := keyNode.Value
+
+		switch {
+		case key == patchDirective:
+			continue
+
+		case key == retainKeysDirective:
+			retainKeys = valueNode
+
+		case strings.HasPrefix(key, setElementOrderPrefix):
+			field := strings.TrimPrefix(key, setElementOrderPrefix)
+			orders[field] = valueNode
+			fields = append(fields, field)
+
+		case strings.HasPrefix(key, deleteFromPrimitiveListPrefix):
+			field := strings.TrimPrefix(key, deleteFromPrimitiveListPrefix)
+			deletions[field] = valueNode
+			fields = append(fields, field)
+
+		default:
+			if err := mergeField(target, keyNode, valueNode, meta.field(key)); err != nil {
+				return false, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		list := mappingValue(target, field)
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		if values, ok := deletions[field]; ok {
+			deleteFromPrimitiveList(list, values)
+		}
+
+		if order, ok := orders[field]; ok {
+			setElementOrder(list, order, meta.field(field))
+		}
+	}
+
+	if retainKeys != nil {
+		if retainKeys.Kind != yaml.SequenceNode {
+			return false, fmt.Errorf("%s must be a list", retainKeysDirective)
+		}
+
+		retain := map[string]bool{}
+		for _, item := range retainKeys.Content {
+			retain[item.Value] = true
+		}
+
+		for i := 0; i+1 < len(target.Content); {
+			if retain[target.Content[i].Value] {
+				i += 2
+			} else {
+				target.Content = append(target.Content[:i], target.Content[i+2:]...)
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func mergeField(target *yaml.Node, patchKey *yaml.Node, patchValue *yaml.Node, meta *patchMeta) error {
+	idx := mappingIndex(target, patchKey.Value)
+
+	// null values delete keys
+	if isNull(patchValue) {
+		if idx >= 0 {
+			target.Content = append(target.Content[:idx], target.Content[idx+2:]...)
+		}
+
+		return nil
+	}
+
+	if idx < 0 {
+		// there is nothing to delete
+		if scalarValue(patchValue, patchDirective) == "delete" {
+			return nil
+		}
+
+		target.Content = append(target.Content, patchKey, cleanPatch(patchValue))
+		return nil
+	}
+
+	targetValue := target.Content[idx+1]
+
+	switch {
+	case targetValue.Kind == yaml.MappingNode && patchValue.Kind == yaml.MappingNode:
+		deleted, err := mergeMapping(targetValue, patchValue, meta)
+		if err != nil {
+			return err
+		}
+
+		if deleted {
+			target.Content = append(target.Content[:idx], target.Content[idx+2:]...)
+		}
+
+	case patchValue.Kind == yaml.MappingNode && scalarValue(patchValue, patchDirective) == "delete":
+		target.Content = append(target.Content[:idx], target.Content[idx+2:]...)
+
+	case targetValue.Kind == yaml.SequenceNode && patchValue.Kind == yaml.SequenceNode:
+		return mergeSequence(targetValue, patchValue, meta)
+
+	default:
+		replaceValue(targetValue, cleanPatch(patchValue))
+	}
+
+	return nil
+}
+
+func mergeSequence(target *yaml.Node, patch *yaml.Node, meta *patchMeta) error {
+	// a list can be replaced entirely by adding a `$patch: replace` item
+	items := make([]*yaml.Node, 0, len(patch.Content))
+	replace := false
+
+	for _, item := range patch.Content {
+		if item.Kind == yaml.MappingNode && len(item.Content) == 2 && item.Content[0].Value == patchDirective {
+			switch directive := item.Content[1].Value; directive {
+			case "replace":
+				replace = true
+			case "delete":
+				// without a merge key, there is nothing to delete
+			default:
+				return fmt.Errorf("unknown %s directive %q", patchDirective, directive)
+			}
+
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	switch {
+	case !replace && meta != nil && meta.mergeKey != "":
+		return mergeSequenceByKey(target, items, meta)
+
+	case !replace && meta != nil && meta.mergePrimitives:
+		for _, item := range items {
+			if sequenceIndex(target, item.Value) < 0 {
+				target.Content = append(target.Content, item)
+			}
+		}
+
+	default:
+		target.Content = cleanPatch(&yaml.Node{Kind: yaml.SequenceNode, Content: items}).Content
+	}
+
+	return nil
+}
+
+func mergeSequenceByKey(target *yaml.Node, items []*yaml.Node, meta *patchMeta) error {
+	for _, item := range items {
+		key := mappingValue(item, meta.mergeKey)
+		if item.Kind != yaml.MappingNode || key == nil {
+			target.Content = append(target.Content, cleanPatch(item))
+			continue
+		}
+
+		idx := findByMergeKey(target, meta.mergeKey, key.Value)
+
+		if scalarValue(item, patchDirective) == "delete" {
+			for idx >= 0 {
+				target.Content = append(target.Content[:idx], target.Content[idx+1:]...)
+				idx = findByMergeKey(target, meta.mergeKey, key.Value)
+			}
+
+			continue
+		}
+
+		if idx < 0 {
+			target.Content = append(target.Content, cleanPatch(item))
+			continue
+		}
+
+		deleted, err := mergeMapping(target.Content[idx], item, meta)
+		if err != nil {
+			return fmt.Errorf("[%s=%s]: %w", meta.mergeKey, key.Value, err)
+		}
+
+		if deleted {
+			target.Content = append(target.Content[:idx], target.Content[idx+1:]...)
+		}
+	}
+
+	return nil
+}
+
+func deleteFromPrimitiveList(list *yaml.Node, values *yaml.Node) {
+	for _, value := range values.Content {
+		for idx := sequenceIndex(list, value.Value); idx >= 0; idx = sequenceIndex(list, value.Value) {
+			list.Content = append(list.Content[:idx], list.Content[idx+1:]...)
+		}
+	}
+}
+
+// setElementOrder sorts the list so that all items mentioned in
+// the order come first (in the given order), followed by all other
+// items in their original order.
+func setElementOrder(list *yaml.Node, order *yaml.Node, meta *patchMeta) {
+	identify := func(item *yaml.Node) string {
+		if meta != nil && meta.mergeKey != "" {
+			if key := mappingValue(item, meta.mergeKey); key != nil {
+				return key.Value
+			}
+
+			return ""
+		}
+
+		return item.Value
+	}
+
+	remaining := append([]*yaml.Node{}, list.Content...)
+	sorted := make([]*yaml.Node, 0, len(list.Content))
+
+	for _, o := range order.Content {
+		wanted := identify(o)
+
+		for i, item := range remaining {
+			if identify(item) == wanted {
+				sorted = append(sorted, item)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+
+	list.Content = append(sorted, remaining...)
+}
+
+// replaceValue overwrites the target node in-place, keeping its
+// comments (and, if the type does not change, its style) intact.
+func replaceValue(target *yaml.Node, value *yaml.Node) {
+	if target.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode {
+		if target.Tag != value.Tag {
+			target.Style = value.Style
+		}
+
+		target.Tag = value.Tag
+		target.Value = value.Value
+
+		return
+	}
+
+	head, line, foot := target.HeadComment, target.LineComment, target.FootComment
+	*target = *value
+
+	if target.HeadComment == "" {
+		target.HeadComment = head
+	}
+
+	if target.LineComment == "" {
+		target.LineComment = line
+	}
+
+	if target.FootComment == "" {
+		target.FootComment = foot
+	}
+}
+
+// cleanPatch removes all directives from a patch, so that it can
+// be inserted into the target document.
+func cleanPatch(node *yaml.Node) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		content := make([]*yaml.Node, 0, len(node.Content))
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if key == patchDirective || key == retainKeysDirective || strings.HasPrefix(key, setElementOrderPrefix) || strings.HasPrefix(key, deleteFromPrimitiveListPrefix) {
+				continue
+			}
+
+			content = append(content, node.Content[i], cleanPatch(node.Content[i+1]))
+		}
+
+		node.Content = content
+
+	case yaml.SequenceNode:
+		content := make([]*yaml.Node, 0, len(node.Content))
+
+		for _, item := range node.Content {
+			if item.Kind == yaml.MappingNode && scalarValue(item, patchDirective) != "" {
+				continue
+			}
+
+			content = append(content, cleanPatch(item))
+		}
+
+		node.Content = content
+	}
+
+	return node
+}
+
+/////////////////////////////////////////////////////////////////////
+// helpers
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+func mappingIndex(mapping *yaml.Node, key string) int {
+	if mapping.Kind != yaml.MappingNode {
+		return -1
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if k := mapping.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	idx := mappingIndex(mapping, key)
+	if idx < 0 {
+		return nil
+	}
+
+	return mapping.Content[idx+1]
+}
+
+func scalarValue(mapping *yaml.Node, key string) string {
+	value := mappingValue(mapping, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+
+	return value.Value
+}
+
+func sequenceIndex(list *yaml.Node, value string) int {
+	for i, item := range list.Content {
+		if item.Kind == yaml.ScalarNode && item.Value == value {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func findByMergeKey(list *yaml.Node, mergeKey string, value string) int {
+	for i, item := range list.Content {
+		if key := mappingValue(item, mergeKey); key != nil && key.Value == value {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func loadPatch(t *testing.T, input string) *yaml.Node {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.TrimSpace(input)), &node); err != nil {
+		t.Fatalf("Failed to decode patch: %v", err)
+	}
+
+	return &node
+}
+
+func TestStrategicMergePatchContainers(t *testing.T) {
+	node, obj := loadObject(t, testDeployment)
+
+	patch := loadPatch(t, `
+metadata:
+  labels:
+    tier: frontend
+spec:
+  template:
+    spec:
+      containers:
+        - name: sidecar
+          $patch: delete
+        - name: web
+          image: nginx:1.26
+          env:
+            - name: DEBUG
+              value: "true"
+        - name: metrics
+          image: exporter:2.0
+`)
+
+	if err := obj.StrategicMergePatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+
+	expectYAML(t, node, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+  # managed by the platform team
+  labels:
+    app: web # do not change
+    tier: frontend
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: migrate:1.0
+      containers:
+        # the main application
+        - name: web
+          image: nginx:1.26 # pinned
+          env:
+            - name: DEBUG
+              value: "true"
+        - name: metrics
+          image: exporter:2.0
+`)
+}
+
+func TestStrategicMergePatchReplacesUnknownLists(t *testing.T) {
+	node, obj := loadObject(t, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80 # http
+      name: http
+    - port: 443
+      name: https
+  externalIPs:
+    - 1.2.3.4
+`)
+
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ports": []interface{}{
+				map[string]interface{}{"port": 80, "targetPort": 8080},
+			},
+			"externalIPs": []string{"5.6.7.8"},
+		},
+	}
+
+	if err := obj.StrategicMergePatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+
+	expectYAML(t, node, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80 # http
+      name: http
+      targetPort: 8080
+    - port: 443
+      name: https
+  externalIPs:
+    - 5.6.7.8
+`)
+}
+
+func TestStrategicMergePatchDirectives(t *testing.T) {
+	node, obj := loadObject(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  finalizers: [a, b]
+spec:
+  replicas: 1 # scaled by HPA
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 1
+  template:
+    spec:
+      containers:
+        - name: a
+        - name: b
+        - name: c
+`)
+
+	patch := loadPatch(t, `
+metadata:
+  finalizers: [c]
+  $deleteFromPrimitiveList/finalizers: [a]
+spec:
+  replicas: 3
+  strategy:
+    $retainKeys: [type]
+    type: Recreate
+  template:
+    spec:
+      $setElementOrder/containers:
+        - name: c
+        - name: a
+`)
+
+	if err := obj.StrategicMergePatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+
+	expectYAML(t, node, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  finalizers: [b, c]
+spec:
+  replicas: 3 # scaled by HPA
+  strategy:
+    type: Recreate
+  template:
+    spec:
+      containers:
+        - name: c
+        - name: a
+        - name: b
+`)
+}
+
+func TestStrategicMergePatchReplaceAndDelete(t *testing.T) {
+	node, obj := loadObject(t, `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  annotations:
+    a: b
+spec:
+  # volumes are important
+  volumes:
+    - name: data
+    - name: cache
+  nodeSelector:
+    zone: a
+    disk: ssd
+`)
+
+	patch := loadPatch(t, `
+metadata:
+  annotations: null
+spec:
+  volumes:
+    - $patch: replace
+    - name: config
+  nodeSelector:
+    $patch: replace
+    zone: b
+`)
+
+	if err := obj.StrategicMergePatch(patch); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+
+	expectYAML(t, node, `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  # volumes are important
+  volumes:
+    - name: config
+  nodeSelector:
+    zone: b
+`)
+}
+
+func TestStrategicMergePatchInvalid(t *testing.T) {
+	_, obj := loadObject(t, testDeployment)
+
+	if err := obj.StrategicMergePatch([]string{"a"}); err == nil {
+		t.Error("Should not have been able to apply a non-mapping patch.")
+	}
+
+	if err := obj.StrategicMergePatch(map[string]interface{}{"$patch": "delete"}); err == nil {
+		t.Error("Should not have been able to delete the entire object.")
+	}
+
+	if err := obj.StrategicMergePatch(map[string]interface{}{"spec": map[string]interface{}{"$patch": "unknown"}}); err == nil {
+		t.Error("Should not have been able to apply an unknown directive.")
+	}
+}
+
+func TestStrategicMergePatchHistory(t *testing.T) {
+	node, obj := loadObject(t, testDeployment)
+
+	var original strings.Builder
+	encoder := yaml.NewEncoder(&original)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(node); err != nil {
+		t.Fatalf("Failed to encode YAML: %v", err)
+	}
+
+	doc := obj.Document()
+	doc.EnableHistory()
+
+	if err := obj.StrategicMergePatch(map[string]interface{}{"metadata": map[string]interface{}{"name": "api"}}); err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+
+	if obj.Name() != "api" {
+		t.Fatalf("Expected name to be api, but got %q.", obj.Name())
+	}
+
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("Failed to undo patch: %v", err)
+	}
+
+	expectYAML(t, node, original.String())
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package k8s
+
+// patchMeta describes how a strategic merge patch has to treat the
+// fields of an object. Fields that are not described are merged
+// like a regular JSON merge patch would (i.e. lists are replaced).
+type patchMeta struct {
+	// mergeKey is set for lists of objects which are merged by
+	// comparing the value of this key.
+	mergeKey string
+	// mergePrimitives is true for lists of scalars that are merged
+	// as if they were sets (e.g. finalizers).
+	mergePrimitives bool
+	// fields describes the fields of objects, or of the objects
+	// inside a list.
+	fields map[string]*patchMeta
+}
+
+func (m *patchMeta) field(name string) *patchMeta {
+	if m == nil {
+		return nil
+	}
+
+	return m.fields[name]
+}
+
+func object(fields map[string]*patchMeta) *patchMeta {
+	return &patchMeta{fields: fields}
+}
+
+func mergeList(key string, item *patchMeta) *patchMeta {
+	m := &patchMeta{mergeKey: key}
+	if item != nil {
+		m.fields = item.fields
+	}
+
+	return m
+}
+
+var (
+	objectMetaPatchMeta = object(map[string]*patchMeta{
+		"finalizers":      {mergePrimitives: true},
+		"ownerReferences": mergeList("uid", nil),
+	})
+
+	containerPatchMeta = object(map[string]*patchMeta{
+		"ports":         mergeList("containerPort", nil),
+		"env":           mergeList("name", nil),
+		"volumeMounts":  mergeList("mountPath", nil),
+		"volumeDevices": mergeList("devicePath", nil),
+	})
+
+	podSpecPatchMeta = object(map[string]*patchMeta{
+		"containers":                mergeList("name", containerPatchMeta),
+		"initContainers":            mergeList("name", containerPatchMeta),
+		"ephemeralContainers":       mergeList("name", containerPatchMeta),
+		"volumes":                   mergeList("name", nil),
+		"imagePullSecrets":          mergeList("name", nil),
+		"hostAliases":               mergeList("ip", nil),
+		"topologySpreadConstraints": mergeList("topologyKey", nil),
+		"resourceClaims":            mergeList("name", nil),
+		"schedulingGates":           mergeList("name", nil),
+	})
+
+	podTemplateSpecPatchMeta = object(map[string]*patchMeta{
+		"metadata": objectMetaPatchMeta,
+		"spec":     podSpecPatchMeta,
+	})
+
+	workloadPatchMeta = withMetadata(map[string]*patchMeta{
+		"spec": object(map[string]*patchMeta{
+			"template": podTemplateSpecPatchMeta,
+		}),
+	})
+
+	// genericPatchMeta is used for all unknown kinds.
+	genericPatchMeta = withMetadata(nil)
+
+	// patchMetas contains the metadata for the most common
+	// types in the core and apps API groups.
+	patchMetas = map[GroupVersionKind]*patchMeta{
+		{Version: "v1", Kind: "Pod"}: withMetadata(map[string]*patchMeta{
+			"spec": podSpecPatchMeta,
+		}),
+		{Version: "v1", Kind: "PodTemplate"}: withMetadata(map[string]*patchMeta{
+			"template": podTemplateSpecPatchMeta,
+		}),
+		{Version: "v1", Kind: "ReplicationController"}: workloadPatchMeta,
+		{Version: "v1", Kind: "Service"}: withMetadata(map[string]*patchMeta{
+			"spec": object(map[string]*patchMeta{
+				"ports": mergeList("port", nil),
+			}),
+		}),
+		{Group: "apps", Version: "v1", Kind: "Deployment"}:  workloadPatchMeta,
+		{Group: "apps", Version: "v1", Kind: "StatefulSet"}: workloadPatchMeta,
+		{Group: "apps", Version: "v1", Kind: "DaemonSet"}:   workloadPatchMeta,
+		{Group: "apps", Version: "v1", Kind: "ReplicaSet"}:  workloadPatchMeta,
+		{Group: "batch", Version: "v1", Kind: "Job"}:        workloadPatchMeta,
+		{Group: "batch", Version: "v1", Kind: "CronJob"}: withMetadata(map[string]*patchMeta{
+			"spec": object(map[string]*patchMeta{
+				"jobTemplate": object(map[string]*patchMeta{
+					"metadata": objectMetaPatchMeta,
+					"spec": object(map[string]*patchMeta{
+						"template": podTemplateSpecPatchMeta,
+					}),
+				}),
+			}),
+		}),
+	}
+)
+
+func withMetadata(fields map[string]*patchMeta) *patchMeta {
+	all := map[string]*patchMeta{
+		"metadata": objectMetaPatchMeta,
+	}
+
+	for k, v := range fields {
+		all[k] = v
+	}
+
+	return object(all)
+}
+
+func lookupPatchMeta(gvk GroupVersionKind) *patchMeta {
+	if meta, ok := patchMetas[gvk]; ok {
+		return meta
+	}
+
+	return genericPatchMeta
+}
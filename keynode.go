@@ -15,6 +15,10 @@ import (
 type KeyNode interface {
 	fmt.Stringer
 
+	// Like for Node, the head comment does not include the blank lines
+	// before the key, which are kept when it is set. Previously, the
+	// leading line breaks of the yaml.Node's HeadComment were returned
+	// and replaced as well.
 	HeadComment() string
 	LineComment() string
 	FootComment() string
@@ -22,10 +26,16 @@ type KeyNode interface {
 	SetHeadComment(comment string) KeyNode
 	SetLineComment(comment string) KeyNode
 	SetFootComment(comment string) KeyNode
+
+	CommentLines(pos CommentPosition) []string
+	SetCommentLines(pos CommentPosition, lines ...string) KeyNode
+	AppendCommentLine(pos CommentPosition, line string) KeyNode
+	StripComments() KeyNode
 }
 
 type keyNode struct {
 	node *yaml.Node
+	tree *tree
 }
 
 func (n *keyNode) String() string {
@@ -33,7 +43,7 @@ func (n *keyNode) String() string {
 }
 
 func (n *keyNode) HeadComment() string {
-	return n.node.HeadComment
+	return headComment(n.node.HeadComment)
 }
 
 func (n *keyNode) LineComment() string {
@@ -45,16 +55,16 @@ func (n *keyNode) FootComment() string {
 }
 
 func (n *keyNode) SetHeadComment(comment string) KeyNode {
-	n.node.HeadComment = comment
+	n.tree.setComment(n.node, CommentHead, withBlankLines(comment, blankLines(n.node.HeadComment)))
 	return n
 }
 
 func (n *keyNode) SetLineComment(comment string) KeyNode {
-	n.node.LineComment = comment
+	n.tree.setComment(n.node, CommentLine, comment)
 	return n
 }
 
 func (n *keyNode) SetFootComment(comment string) KeyNode {
-	n.node.FootComment = comment
+	n.tree.setComment(n.node, CommentFoot, comment)
 	return n
 }
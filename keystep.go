@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyStep is a path step that matches mapping keys by their value and
+// tag, so that keys like `1`, `true`, `null` or complex keys like
+// `? [a, b]` can be reached. A plain string step matches any scalar
+// key with the same text, whereas Key("1") only matches the string
+// key `"1"` and Key(1) only matches the integer key `1`. Complex keys
+// are matched by structural equality, ignoring comments, styles and
+// the order of mapping keys.
+type KeyStep struct {
+	node *yaml.Node
+	err  error
+}
+
+// Key creates a KeyStep for the given value. The value is encoded like
+// any other value given to Set(); a *yaml.Node or Node is used as-is.
+// Errors during encoding are reported when the path is used.
+func Key(value interface{}) KeyStep {
+	switch v := value.(type) {
+	case *yaml.Node:
+		return KeyStep{node: cloneNode(v)}
+	case Node:
+		return KeyStep{node: cloneNode(rawNode(v))}
+	}
+
+	n, err := createNode(value)
+	if err != nil {
+		return KeyStep{err: fmt.Errorf("invalid key: %w", err)}
+	}
+
+	return KeyStep{node: n}
+}
+
+// Node returns a copy of the key's node.
+func (k KeyStep) Node() *yaml.Node {
+	if k.node == nil {
+		return nil
+	}
+
+	return cloneNode(k.node)
+}
+
+// String returns the key in YAML flow notation, e.g. `1`, `"1"` or
+// `[a, b]`.
+func (k KeyStep) String() string {
+	if k.node == nil {
+		return "<invalid key>"
+	}
+
+	flow := cloneNode(k.node)
+	setFlowStyle(flow)
+
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(flow); err != nil {
+		return "<invalid key>"
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+// MarshalYAML encodes the key as `{key: <value>}`, so that paths can
+// be serialized (e.g. by ExportHistory()) and told apart from string
+// and int steps.
+func (k KeyStep) MarshalYAML() (interface{}, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+
+	return map[string]*yaml.Node{"key": k.node}, nil
+}
+
+// decodeStep turns a step decoded into an interface{} back into a
+// KeyStep, if it was encoded by KeyStep.MarshalYAML().
+func decodeStep(step Step) Step {
+	if m, ok := step.(map[string]interface{}); ok && len(m) == 1 {
+		if value, exists := m["key"]; exists {
+			return Key(value)
+		}
+	}
+
+	return step
+}
+
+func setFlowStyle(n *yaml.Node) {
+	if n.Kind != yaml.ScalarNode {
+		n.Style |= yaml.FlowStyle
+	}
+
+	n.HeadComment = ""
+	n.LineComment = ""
+	n.FootComment = ""
+
+	for _, child := range n.Content {
+		setFlowStyle(child)
+	}
+}
+
+func (k KeyStep) matches(key *yaml.Node) bool {
+	return equalNodes(key, k.node, SemanticEqual)
+}
+
+// positions returns the positions of all matching keys in the
+// mapping's Content. The index is optional and only helps for scalar
+// keys.
+func (k KeyStep) positions(mapping *yaml.Node, index *keyIndex) []int {
+	if k.node == nil {
+		return nil
+	}
+
+	var positions []int
+
+	if k.node.Kind == yaml.ScalarNode && k.node.ShortTag() == "!!str" {
+		// the index is keyed by the raw value, so its hits only need
+		// to be checked for their tag
+		for _, pos := range findKeys(mapping, k.node.Value, index) {
+			if k.matches(mapping.Content[pos]) {
+				positions = append(positions, pos)
+			}
+		}
+
+		return positions
+	}
+
+	for pos := 0; pos+1 < len(mapping.Content); pos += 2 {
+		if k.matches(mapping.Content[pos]) {
+			positions = append(positions, pos)
+		}
+	}
+
+	return positions
+}
+
+// keyPositions returns the positions of all keys in the mapping that
+// match the given string or KeyStep.
+func keyPositions(mapping *yaml.Node, step Step, index *keyIndex) []int {
+	switch s := step.(type) {
+	case string:
+		return findKeys(mapping, s, index)
+	case KeyStep:
+		return s.positions(mapping, index)
+	default:
+		return nil
+	}
+}
+
+// isKeyStep returns true for steps that descend into mappings.
+func isKeyStep(step Step) bool {
+	switch step.(type) {
+	case string, KeyStep:
+		return true
+	default:
+		return false
+	}
+}
+
+// keyStep returns the step to reach the value of the given key node:
+// a plain string for scalar keys and a KeyStep for complex keys.
+func keyStep(key *yaml.Node) Step {
+	if key.Kind == yaml.ScalarNode {
+		return key.Value
+	}
+
+	return Key(key)
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const typedKeysInput = `
+1: int
+"1": string
+true: bool
+null: nothing
+? [a, b]
+: list
+? {x: 1}
+: map
+`
+
+func TestKeyStepGet(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(typedKeysInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	testcases := []struct {
+		step     Step
+		expected string
+	}{
+		{step: Key(1), expected: "int"},
+		{step: Key("1"), expected: "string"},
+		{step: Key(true), expected: "bool"},
+		{step: Key(nil), expected: "nothing"},
+		{step: Key([]string{"a", "b"}), expected: "list"},
+		{step: Key(map[string]int{"x": 1}), expected: "map"},
+		// plain strings match any scalar key with the same text
+		{step: "1", expected: "int"},
+		{step: "true", expected: "bool"},
+	}
+
+	for _, tc := range testcases {
+		value, ok := doc.Get(tc.step)
+		if !ok {
+			t.Errorf("Expected to find %v.", tc.step)
+			continue
+		}
+
+		if value.ToString() != tc.expected {
+			t.Errorf("Expected %v to be %q, but got %q.", tc.step, tc.expected, value.ToString())
+		}
+	}
+
+	if _, ok := doc.Get(Key(2)); ok {
+		t.Error("Expected Key(2) to not exist.")
+	}
+
+	if _, ok := doc.Get(Key("true")); ok {
+		t.Error("Expected Key(\"true\") to not match the boolean key.")
+	}
+
+	key, ok := doc.GetKey(Key([]string{"a", "b"}))
+	if !ok {
+		t.Fatal("Expected to find key node.")
+	}
+
+	if kind := key.(*keyNode).node.Kind; kind != yaml.SequenceNode {
+		t.Fatalf("Expected key node to be a sequence, but got %v.", KindName(kind))
+	}
+}
+
+func TestKeyStepSet(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(typedKeysInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	if _, err := doc.SetKey(Key(1), "updated"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{Key([]string{"a", "b"})}, "updated"); err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{Key(2), Key(false)}, "new"); err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+
+	if err := doc.DeleteKey(Key(map[string]int{"x": 1})); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	expectYAML(t, node, `
+1: updated
+"1": string
+true: bool
+null: nothing
+? [a, b]
+: updated
+2:
+  false: new
+`)
+
+	history, err := doc.ExportHistory()
+	if err != nil {
+		t.Fatalf("Failed to export history: %v", err)
+	}
+
+	if err := doc.ImportHistory(history); err != nil {
+		t.Fatalf("Failed to import history: %v", err)
+	}
+
+	for doc.CanUndo() {
+		if err := doc.Undo(); err != nil {
+			t.Fatalf("Failed to undo: %v", err)
+		}
+	}
+
+	expectYAML(t, node, strings.TrimSpace(typedKeysInput))
+}
+
+func TestKeyStepString(t *testing.T) {
+	path := Path{"foo", Key("1"), Key(1), Key([]string{"a", "b"})}
+
+	if s := path.String(); s != `foo."1".1.[a, b]` {
+		t.Fatalf("Unexpected path string %q.", s)
+	}
+
+	if err := (Path{KeyStep{}}).Validate(); err == nil {
+		t.Fatal("Expected invalid key to be rejected.")
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarkerPrefix is the prefix for marker comments like
+// "# yamled:image=web".
+const MarkerPrefix = "yamled:"
+
+var markerComment = regexp.MustCompile(`(?:^|\s)` + regexp.QuoteMeta(MarkerPrefix) + `([A-Za-z0-9_.\-/$]+)(?:=(\S+))?`)
+
+// Marker is a node that carries a marker in its line comment. Two
+// styles of markers are recognized:
+//
+//	image: nginx:1.25 # yamled:image=web
+//	image: nginx:1.25 # {"$imagepolicy": "flux-system:web"}
+//
+// The first marker is named "image" and has the value "web", the
+// second one (as used by Flux) is named "$imagepolicy" and has the
+// value "flux-system:web". Markers on the key of a mapping or sequence
+// apply to its value.
+type Marker struct {
+	Name  string
+	Value string
+	// Path is the path to the marked node.
+	Path Path
+	// Node is the marked node.
+	Node Node
+}
+
+// Markers returns all markers with the given name in document order;
+// if name is empty, all markers are returned.
+func (d *document) Markers(name string) []Marker {
+	root, err := d.RootNode()
+	if err != nil {
+		return nil
+	}
+
+	var markers []Marker
+	findMarkers(root.(*node), nil, Path{}, func(m Marker) {
+		if name == "" || m.Name == name {
+			markers = append(markers, m)
+		}
+	})
+
+	return markers
+}
+
+// SetMarkers sets all nodes marked with the given name and value (an
+// empty value matches all values) to a new value, keeping the marker
+// comments intact. Either all or none of the nodes are changed. The
+// number of changed nodes is returned.
+func (d *document) SetMarkers(name string, value string, newValue interface{}) (int, error) {
+	// a node can carry multiple matching markers, but must only be
+	// set once
+	var paths []Path
+	seen := map[string]bool{}
+
+	for _, marker := range d.Markers(name) {
+		if value != "" && marker.Value != value {
+			continue
+		}
+
+		if key := marker.Path.String(); !seen[key] {
+			seen[key] = true
+			paths = append(paths, marker.Path)
+		}
+	}
+
+	err := d.Transaction(func(Tx) error {
+		for _, path := range paths {
+			if err := d.setMarked(path, newValue); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(paths), nil
+}
+
+// setMarked replaces the node at the path and moves its line comment
+// to the new node.
+func (d *document) setMarked(path Path, value interface{}) error {
+	root, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	return d.mutate(path, func() error {
+		// the root node is not replaced, but updated in-place
+		if len(path) == 0 {
+			comment := root.LineComment()
+			if err := root.Set(value); err != nil {
+				return err
+			}
+
+			root.SetLineComment(comment)
+			return nil
+		}
+
+		comment := root.MustGet(path...).LineComment()
+
+		updated, err := root.SetAt(path, value)
+		if err != nil {
+			return err
+		}
+
+		updated.SetLineComment(comment)
+
+		return nil
+	})
+}
+
+func findMarkers(n *node, key *yaml.Node, path Path, found func(Marker)) {
+	comments := []string{n.LineComment()}
+	if key != nil {
+		comments = append(comments, key.LineComment)
+	}
+
+	for _, comment := range comments {
+		for _, m := range parseMarkers(comment) {
+			m.Path = copyPath(path)
+			m.Node = n
+			found(m)
+		}
+	}
+
+	switch n.node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.node.Content); i += 2 {
+			key := n.node.Content[i]
+			findMarkers(n.child(n.node.Content[i+1]), key, append(copyPath(path), keyStep(key)), found)
+		}
+
+	case yaml.SequenceNode:
+		for i, item := range n.node.Content {
+			findMarkers(n.child(item), nil, append(copyPath(path), i), found)
+		}
+	}
+}
+
+// parseMarkers returns all markers in a line comment, without path and
+// node.
+func parseMarkers(comment string) []Marker {
+	comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), "#"))
+	if comment == "" {
+		return nil
+	}
+
+	// Flux-style JSON markers
+	if strings.HasPrefix(comment, "{") {
+		var values map[string]string
+		if err := json.Unmarshal([]byte(comment), &values); err != nil {
+			return nil
+		}
+
+		var markers []Marker
+		for name, value := range values {
+			markers = append(markers, Marker{Name: name, Value: value})
+		}
+
+		// map iteration order is random
+		sort.Slice(markers, func(i, j int) bool {
+			return markers[i].Name < markers[j].Name
+		})
+
+		return markers
+	}
+
+	var markers []Marker
+	for _, match := range markerComment.FindAllStringSubmatch(comment, -1) {
+		markers = append(markers, Marker{Name: match[1], Value: match[2]})
+	}
+
+	return markers
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+const markersInput = `
+web:
+  image: nginx:1.24 # yamled:image=web
+  replicas: 3 # yamled:scale
+sidecar:
+  image: envoy:1.0 # {"$imagepolicy": "flux-system:envoy"}
+jobs:
+  - busybox:1.0 # yamled:image=web
+labels: # yamled:labels
+  app: web
+`
+
+func TestMarkers(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(markersInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var found []string
+	for _, m := range doc.Markers("") {
+		found = append(found, m.Path.String()+" "+m.Name+"="+m.Value)
+	}
+
+	expected := []string{
+		"web.image image=web",
+		"web.replicas scale=",
+		"sidecar.image $imagepolicy=flux-system:envoy",
+		"jobs.[0] image=web",
+		"labels labels=",
+	}
+
+	if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected markers\n%s\n\nbut got\n\n%s", strings.Join(expected, "\n"), strings.Join(found, "\n"))
+	}
+
+	images := doc.Markers("image")
+	if len(images) != 2 || images[1].Node.ToString() != "busybox:1.0" {
+		t.Fatalf("Unexpected image markers: %v", images)
+	}
+}
+
+func TestSetMarkers(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(markersInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	count, err := doc.SetMarkers("image", "web", "nginx:1.25")
+	if err != nil {
+		t.Fatalf("Failed to set markers: %v", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("Expected 2 nodes to be changed, but got %d.", count)
+	}
+
+	if _, err := doc.SetMarkers("$imagepolicy", "", "envoy:1.1"); err != nil {
+		t.Fatalf("Failed to set markers: %v", err)
+	}
+
+	// all or nothing
+	if err := doc.Protect("web.replicas"); err != nil {
+		t.Fatalf("Failed to protect path: %v", err)
+	}
+
+	if _, err := doc.SetMarkers("", "", "x"); err == nil {
+		t.Fatal("Expected read-only node to prevent the change.")
+	}
+
+	expectYAML(t, node, `
+web:
+  image: nginx:1.25 # yamled:image=web
+  replicas: 3 # yamled:scale
+sidecar:
+  image: envoy:1.1 # {"$imagepolicy": "flux-system:envoy"}
+jobs:
+  - nginx:1.25 # yamled:image=web
+labels: # yamled:labels
+  app: web
+`)
+}
+
+func TestSetMarkersOncePerNode(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(`
+images: # yamled:images
+  web: nginx:1.24 # yamled:image=web yamled:image=frontend
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	count, err := doc.SetMarkers("image", "", "nginx:1.25")
+	if err != nil {
+		t.Fatalf("Failed to set markers: %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 node to be changed, but got %d.", count)
+	}
+
+	expectYAML(t, node, `
+images: # yamled:images
+  web: nginx:1.25 # yamled:image=web yamled:image=frontend
+`)
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MatchStep is a path step that selects the first item of a sequence
+// that is a mapping with the given field set to the given value, like
+// the container named "web" in a list of containers. Values are
+// compared regardless of their type, so Where("port", 80) also
+// matches `port: "80"`.
+type MatchStep struct {
+	field  string
+	value  *yaml.Node
+	create bool
+	err    error
+}
+
+// Where creates a MatchStep for items whose field has the given value.
+func Where(field string, value interface{}) MatchStep {
+	n, err := createNode(value)
+	if err != nil {
+		return MatchStep{field: field, err: fmt.Errorf("invalid value for %q: %w", field, err)}
+	}
+
+	return MatchStep{field: field, value: n}
+}
+
+// OrCreate returns a copy of the step that makes SetAt() append a new
+// item with the field set to the value if no item matches.
+func (m MatchStep) OrCreate() MatchStep {
+	m.create = true
+	return m
+}
+
+// Field returns the name of the field that is matched.
+func (m MatchStep) Field() string {
+	return m.field
+}
+
+// String returns the step as "[field=value]". Fields and values that
+// contain special characters are quoted.
+func (m MatchStep) String() string {
+	value := "<invalid>"
+	if m.value != nil {
+		value = KeyStep{node: m.value}.String()
+		if m.value.Kind == yaml.ScalarNode {
+			value = quoteMatchValue(m.value.Value)
+		}
+	}
+
+	return fmt.Sprintf("[%s=%s]", quoteMatchValue(m.field), value)
+}
+
+func quoteMatchValue(s string) string {
+	if s == "" || strings.ContainsAny(s, `[]=."' `) {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// index returns the position of the first matching item in the
+// sequence, or -1.
+func (m MatchStep) index(sequence *yaml.Node) int {
+	if m.value == nil || sequence.Kind != yaml.SequenceNode {
+		return -1
+	}
+
+	for i, item := range sequence.Content {
+		if m.matches(item) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m MatchStep) matches(item *yaml.Node) bool {
+	item = resolveAlias(item)
+	if item.Kind != yaml.MappingNode {
+		return false
+	}
+
+	pos := findKey(item, m.field, nil)
+	if pos < 0 {
+		return false
+	}
+
+	return equalNodes(item.Content[pos+1], m.value, EqualOptions{
+		IgnoreComments: true,
+		IgnoreStyles:   true,
+		IgnoreKeyOrder: true,
+		IgnoreTags:     true,
+	})
+}
+
+// newItem turns the node that is about to be added to the sequence
+// into an item that matches this step.
+func (m MatchStep) newItem(n *yaml.Node) (*yaml.Node, error) {
+	switch {
+	case isNullNode(n):
+		shallowCopyNode(n, *mappingNode())
+	case n.Kind != yaml.MappingNode:
+		return nil, fmt.Errorf("cannot create item for %v: value must be a mapping, but is %v", m, KindName(n.Kind))
+	}
+
+	if m.matches(n) {
+		return n, nil
+	}
+
+	if pos := findKey(n, m.field, nil); pos >= 0 {
+		return nil, fmt.Errorf("cannot create item for %v: value has a different %q", m, m.field)
+	}
+
+	// put the field first, as is customary for names
+	n.Content = append([]*yaml.Node{stringNode(m.field), cloneNode(m.value)}, n.Content...)
+
+	return n, nil
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+const containersInput = `
+containers:
+  - name: web
+    image: nginx
+    ports:
+      - port: 80
+  - name: sidecar
+    image: envoy
+`
+
+func TestMatchStepGet(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(containersInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if image := doc.MustGet("containers", Where("name", "sidecar"), "image").ToString(); image != "envoy" {
+		t.Fatalf("Expected envoy, but got %q.", image)
+	}
+
+	// values are compared regardless of their type
+	path, err := ParsePath("containers[name=web].ports[port=80]")
+	if err != nil {
+		t.Fatalf("Failed to parse path: %v", err)
+	}
+
+	if _, ok := doc.Get(path...); !ok {
+		t.Fatalf("Expected to find %v.", path)
+	}
+
+	if _, ok := doc.Get("containers", Where("name", "missing")); ok {
+		t.Fatal("Expected non-matching step to not be found.")
+	}
+
+	if _, ok := doc.Get(Where("name", "web")); ok {
+		t.Fatal("Expected matcher on a mapping to not be found.")
+	}
+}
+
+func TestMatchStepSetAndDelete(t *testing.T) {
+	node, doc, err := yamlLoad(strings.TrimSpace(containersInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	doc.EnableHistory()
+
+	if _, err := doc.SetAt(Path{"containers", Where("name", "web"), "image"}, "nginx:1.25"); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"containers", Where("name", "db"), "image"}, "postgres"); err == nil {
+		t.Fatal("Expected missing item to not be created.")
+	}
+
+	if _, err := doc.SetAt(Path{"containers", Where("name", "db").OrCreate(), "image"}, "postgres"); err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"init", Where("name", "setup").OrCreate()}, map[string]string{"image": "busybox"}); err != nil {
+		t.Fatalf("Failed to create item in new list: %v", err)
+	}
+
+	if err := doc.DeleteKey("containers", Where("name", "sidecar")); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	expectYAML(t, node, `
+containers:
+  - name: web
+    image: nginx:1.25
+    ports:
+      - port: 80
+  - name: db
+    image: postgres
+init:
+  - name: setup
+    image: busybox
+`)
+
+	for doc.CanUndo() {
+		if err := doc.Undo(); err != nil {
+			t.Fatalf("Failed to undo: %v", err)
+		}
+	}
+
+	expectYAML(t, node, containersInput)
+}
+
+func TestMatchStepString(t *testing.T) {
+	testcases := []struct {
+		path     Path
+		expected string
+	}{
+		{path: Path{"containers", Where("name", "web"), "image"}, expected: "containers[name=web].image"},
+		{path: Path{Where("port", 80)}, expected: "[port=80]"},
+		{path: Path{"env", Where("name", "a.b")}, expected: `env[name="a.b"]`},
+	}
+
+	for _, tc := range testcases {
+		if s := tc.path.String(); s != tc.expected {
+			t.Errorf("Expected %q, but got %q.", tc.expected, s)
+			continue
+		}
+
+		parsed, err := ParsePath(tc.expected)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tc.expected, err)
+			continue
+		}
+
+		if parsed.String() != tc.expected {
+			t.Errorf("Expected %q to survive a roundtrip, but got %q.", tc.expected, parsed.String())
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
 
 	"gopkg.in/yaml.v3"
 )
@@ -35,7 +36,13 @@ type Node interface {
 	ReplaceKey(key Step, value interface{}) (Node, error)
 	ReplaceAt(path Path, value interface{}) (Node, error)
 
+	UpdateFrom(value interface{}) error
+
 	DeleteKey(steps ...Step) error
+	DeleteAt(path Path, opts DeleteOptions) error
+
+	// Clone returns a deep copy of the node.
+	Clone() Node
 
 	ToString() string
 	ToInt() int
@@ -44,6 +51,12 @@ type Node interface {
 	ToMap() map[string]interface{}
 	To(val interface{}) error
 
+	// The head comment does not include the blank lines before the
+	// node, which are kept when it is set; see SetBlankLinesBefore().
+	// Before blank lines were supported, HeadComment() returned the
+	// yaml.Node's HeadComment unchanged, including leading line breaks,
+	// and SetHeadComment() replaced them. Use the yaml.Node directly if
+	// the raw value is needed.
 	HeadComment() string
 	LineComment() string
 	FootComment() string
@@ -51,10 +64,96 @@ type Node interface {
 	SetHeadComment(comment string) Node
 	SetLineComment(comment string) Node
 	SetFootComment(comment string) Node
+
+	CommentLines(pos CommentPosition) []string
+	SetCommentLines(pos CommentPosition, lines ...string) Node
+	AppendCommentLine(pos CommentPosition, line string) Node
+	StripComments() Node
+	FindComments(pattern *regexp.Regexp) []CommentMatch
+	// SetCommentBefore and SetCommentAfter set the comments around the
+	// entry at the given path, no matter if it is a key or an item.
+	SetCommentBefore(path Path, lines ...string) error
+	SetCommentAfter(path Path, lines ...string) error
+
+	// BlankLinesBefore and SetBlankLinesBefore control the number of
+	// blank lines before the entry at the given path.
+	BlankLinesBefore(path Path) int
+	SetBlankLinesBefore(path Path, count int) error
 }
 
 type node struct {
 	node *yaml.Node
+	// tree is shared by all nodes of a document; it is nil for
+	// standalone nodes.
+	tree *tree
+}
+
+// tree holds the settings and caches shared by all nodes of a document.
+type tree struct {
+	index      *keyIndex
+	duplicates DuplicateKeyPolicy
+	// doc is the document the nodes belong to, so that changes made
+	// through its nodes can be recorded; it is nil for nodes that do
+	// not belong to a document.
+	doc *document
+}
+
+func (t *tree) keyIndex() *keyIndex {
+	if t == nil {
+		return nil
+	}
+
+	return t.index
+}
+
+func (t *tree) duplicateKeyPolicy() DuplicateKeyPolicy {
+	if t == nil {
+		return DuplicatesUseFirst
+	}
+
+	return t.duplicates
+}
+
+// setComment changes a comment of a node in the tree and records the
+// change if the tree belongs to a document.
+func (t *tree) setComment(n *yaml.Node, field CommentPosition, comment string) {
+	if t == nil || t.doc == nil {
+		*commentTarget(n, field) = comment
+		return
+	}
+
+	t.doc.setNodeComment(n, field, comment)
+}
+
+// stripComments removes all comments from a node in the tree and its
+// children.
+func (t *tree) stripComments(n *yaml.Node) {
+	if t == nil || t.doc == nil {
+		stripComments(n)
+		return
+	}
+
+	t.doc.stripNodeComments(n)
+}
+
+// change runs fn, which changes a node in the tree and its children.
+func (t *tree) change(n *yaml.Node, fn func() error) error {
+	if t == nil || t.doc == nil {
+		return fn()
+	}
+
+	return t.doc.changeNode(n, fn)
+}
+
+// changeAt runs fn, which changes the tree at the path relative to the
+// node n, through the document, so that changes made via nodes are
+// treated like changes made using the Document API.
+func (t *tree) changeAt(n *yaml.Node, path Path, mode nodeChange, fn func() error) error {
+	if t == nil || t.doc == nil {
+		return fn()
+	}
+
+	return t.doc.changeNodeAt(n, path, mode, fn)
 }
 
 func NewNode(n *yaml.Node) (Node, error) {
@@ -81,6 +180,14 @@ func NewNodeFromReader(r io.Reader) (Node, error) {
 	return NewNode(&node)
 }
 
+// child wraps a child node of the same document.
+func (n *node) child(c *yaml.Node) *node {
+	return &node{
+		node: c,
+		tree: n.tree,
+	}
+}
+
 func (n *node) Bytes(indent int) ([]byte, error) {
 	var buf bytes.Buffer
 	encoder := yaml.NewEncoder(&buf)
@@ -114,16 +221,17 @@ func (n *node) Style() yaml.Style {
 }
 
 func (n *node) SetStyle(style yaml.Style) error {
-	n.node.Style = style
-
-	return nil
+	return n.tree.changeAt(n.node, nil, changeInPlace, func() error {
+		n.node.Style = style
+		return nil
+	})
 }
 
 /////////////////////////////////////////////////////////////////////
 // comment API passthrough
 
 func (n *node) HeadComment() string {
-	return n.node.HeadComment
+	return headComment(n.node.HeadComment)
 }
 
 func (n *node) LineComment() string {
@@ -135,17 +243,17 @@ func (n *node) FootComment() string {
 }
 
 func (n *node) SetHeadComment(comment string) Node {
-	n.node.HeadComment = comment
+	n.tree.setComment(n.node, CommentHead, withBlankLines(comment, blankLines(n.node.HeadComment)))
 	return n
 }
 
 func (n *node) SetLineComment(comment string) Node {
-	n.node.LineComment = comment
+	n.tree.setComment(n.node, CommentLine, comment)
 	return n
 }
 
 func (n *node) SetFootComment(comment string) Node {
-	n.node.FootComment = comment
+	n.tree.setComment(n.node, CommentFoot, comment)
 	return n
 }
 
@@ -186,33 +294,26 @@ func (n *node) GetKey(steps ...Step) (KeyNode, bool) {
 	}
 
 	step := steps[len(steps)-1]
+	if !isKeyStep(step) {
+		return nil, false
+	}
 
-	// mappings are represented as [keyNode, valueNode, keyNode, valueNode, ...]
-	// in this node's content
-	for i := 0; i < len(curNode.Content); i += 2 {
-		kNode := curNode.Content[i]
-
-		// safety check
-		if kNode.Kind != yaml.ScalarNode {
-			continue
-		}
-
-		// we found the key!
-		if kNode.Value == step {
-			return &keyNode{
-				node: kNode,
-			}, true
-		}
+	i, err := n.tree.findKey(curNode, step, false)
+	if err != nil || i < 0 {
+		// key not found
+		return nil, false
 	}
 
-	// key not found
-	return nil, false
+	return &keyNode{
+		node: curNode.Content[i],
+		tree: n.tree,
+	}, true
 }
 
 func (n *node) MustGet(steps ...Step) Node {
 	child, found, _ := n.get(steps...)
 	if !found {
-		return &node{nullNode()}
+		return &node{node: nullNode()}
 	}
 
 	return child
@@ -250,41 +351,22 @@ func (n *node) get(steps ...Step) (Node, bool, bool) {
 	}
 
 	switch step := steps[0].(type) {
-	// string means descending into an object
-	case string:
+	// string (or a typed key) means descending into an object
+	case string, KeyStep:
 		if n.node.Kind != yaml.MappingNode {
 			return nil, false, true
 		}
 
 		// mappings are represented as [keyNode, valueNode, keyNode, valueNode, ...]
 		// in this node's content
-		for i := 0; i < len(n.node.Content); i += 2 {
-			keyNode := n.node.Content[i]
-
-			// safety check
-			if keyNode.Kind != yaml.ScalarNode {
-				continue
-			}
-
-			// we found the key! next content item will be the value
-			if keyNode.Value == step {
-				// safety check
-				if i+1 >= len(n.node.Content) {
-					return nil, false, false
-				}
-
-				node, err := NewNode(n.node.Content[i+1])
-				if err != nil {
-					return nil, false, false
-				}
-
-				// success!
-				return node, true, false
-			}
+		i, err := n.tree.findKey(n.node, step, false)
+		if err != nil || i < 0 {
+			// key not found (or not unique)
+			return nil, false, false
 		}
 
-		// key not found
-		return nil, false, false
+		// success!
+		return n.child(n.node.Content[i+1]), true, false
 
 	// int means descending into an array
 	case int:
@@ -292,17 +374,31 @@ func (n *node) get(steps ...Step) (Node, bool, bool) {
 			return nil, false, true
 		}
 
-		if step >= len(n.node.Content) {
+		step = sequenceIndex(n.node, step)
+		if step < 0 || step >= len(n.node.Content) {
 			return nil, false, false
 		}
 
-		node, err := NewNode(n.node.Content[step])
-		if err != nil {
+		// success!
+		return n.child(n.node.Content[step]), true, false
+
+	// End never exists, but is still only valid for arrays
+	case AppendStep:
+		return nil, false, n.node.Kind != yaml.SequenceNode
+
+	// a matcher selects an array item by one of its fields
+	case MatchStep:
+		if n.node.Kind != yaml.SequenceNode {
+			return nil, false, true
+		}
+
+		i := step.index(n.node)
+		if i < 0 {
 			return nil, false, false
 		}
 
 		// success!
-		return node, true, false
+		return n.child(n.node.Content[i]), true, false
 	}
 
 	// cannot handle this type of step
@@ -326,7 +422,9 @@ func (n *node) set(value interface{}, forbidKindChange bool) error {
 		return err
 	}
 
-	return n.setNode(parsed, forbidKindChange)
+	return n.tree.changeAt(n.node, nil, changeReplacing, func() error {
+		return n.setNode(parsed, forbidKindChange)
+	})
 }
 
 func (n *node) setNode(newNode *yaml.Node, forbidKindChange bool) error {
@@ -334,17 +432,18 @@ func (n *node) setNode(newNode *yaml.Node, forbidKindChange bool) error {
 		return errors.New("cannot set a new node kind without replacing the node")
 	}
 
-	deepCopyNode(n.node, *newNode)
+	n.tree.keyIndex().removed(n.node)
+	shallowCopyNode(n.node, *newNode)
 
 	return nil
 }
 
 func (n *node) SetKey(key Step, value interface{}) (Node, error) {
-	return n.setKey(key, value, true)
+	return n.setAt(Path{key}, value, true)
 }
 
 func (n *node) ReplaceKey(key Step, value interface{}) (Node, error) {
-	return n.setKey(key, value, false)
+	return n.setAt(Path{key}, value, false)
 }
 
 func (n *node) setKey(key Step, value interface{}, forbidKindChange bool) (Node, error) {
@@ -357,60 +456,87 @@ func (n *node) setKey(key Step, value interface{}, forbidKindChange bool) (Node,
 		return nil, err
 	}
 
-	return NewNode(newNode)
+	return n.child(newNode), nil
 }
 
 func (n *node) setKeyNode(key Step, newNode *yaml.Node, forbidKindChange bool) error {
 	switch n.node.Kind {
 	case yaml.MappingNode:
-		step, ok := key.(string)
-		if !ok {
-			return errors.New("invalid key type, must be string")
+		if !isKeyStep(key) {
+			return errors.New("invalid key type, must be string or KeyStep")
 		}
 
 		// try to find the key
-		for i := 0; i < len(n.node.Content); i += 2 {
-			keyNode := n.node.Content[i]
+		i, err := n.tree.findKey(n.node, key, true)
+		if err != nil {
+			return err
+		}
 
-			// safety check
-			if keyNode.Kind != yaml.ScalarNode {
-				continue
+		if i >= 0 {
+			if forbidKindChange && !compatibleKinds(n.node.Content[i+1], newNode) {
+				return errors.New("cannot change the node's kind")
 			}
 
-			// we found the key! next content item will be the value
-			if keyNode.Value == step {
-				// safety check
-				if i+1 >= len(n.node.Content) {
-					return errors.New("found key node, but current object has no value node")
-				}
-
-				if forbidKindChange && !compatibleKinds(n.node.Content[i+1], newNode) {
-					return errors.New("cannot change the node's kind")
-				}
+			// success!
+			n.tree.keyIndex().removed(n.node.Content[i+1])
+			n.node.Content[i+1] = newNode
+			return nil
+		}
 
-				// success!
-				n.node.Content[i+1] = newNode
-				return nil
+		// key was not yet found, let's insert one automagically
+		var newKey *yaml.Node
+		if k, ok := key.(KeyStep); ok {
+			if k.err != nil {
+				return k.err
 			}
+
+			newKey = cloneNode(k.node)
+		} else {
+			newKey = stringNode(key.(string))
 		}
 
-		// key was not yet found, let's insert one automagically
-		n.node.Content = append(n.node.Content,
-			stringNode(step),
-			newNode,
-		)
+		n.node.Content = append(n.node.Content, newKey, newNode)
+		n.tree.keyIndex().appended(n.node, newKey)
 
 		// success!
 		return nil
 
 	case yaml.SequenceNode:
-		step, ok := key.(int)
-		if !ok {
-			return errors.New("invalid key type, must be int")
+		var step int
+		switch k := key.(type) {
+		case int:
+			step = sequenceIndex(n.node, k)
+		case AppendStep:
+			step = len(n.node.Content)
+		case MatchStep:
+			if k.err != nil {
+				return k.err
+			}
+
+			step = k.index(n.node)
+			if step >= 0 {
+				break
+			}
+
+			if !k.create {
+				return fmt.Errorf("no item matches %v", k)
+			}
+
+			item, err := k.newItem(newNode)
+			if err != nil {
+				return err
+			}
+
+			n.node.Content = append(n.node.Content, item)
+
+			// success!
+			return nil
+		default:
+			return errors.New("invalid key type, must be int, End or a MatchStep")
 		}
 
 		if step < 0 {
-			return errors.New("step must be >= 0")
+			return fmt.Errorf("index %v is out of range", key)
 		}
 
 		// insert enough empty nodes to fill up the content
@@ -422,6 +548,7 @@ func (n *node) setKeyNode(key Step, newNode *yaml.Node, forbidKindChange bool) e
 			return errors.New("cannot change the node's kind")
 		}
 
+		n.tree.keyIndex().removed(n.node.Content[step])
 		n.node.Content[step] = newNode
 
 		// success!
@@ -441,6 +568,17 @@ func (n *node) ReplaceAt(path Path, value interface{}) (Node, error) {
 }
 
 func (n *node) setAt(path Path, value interface{}, forbidKindChange bool) (Node, error) {
+	var result Node
+
+	err := n.tree.changeAt(n.node, path, changeReplacing, func() (err error) {
+		result, err = n.setPath(path, value, forbidKindChange)
+		return err
+	})
+
+	return result, err
+}
+
+func (n *node) setPath(path Path, value interface{}, forbidKindChange bool) (Node, error) {
 	if len(path) == 0 {
 		return nil, errors.New("path cannot be empty")
 	}
@@ -456,6 +594,13 @@ func (n *node) setAt(path Path, value interface{}, forbidKindChange bool) (Node,
 
 	head, tail := path.Consume()
 
+	// resolve duplicate keys according to the policy before descending
+	if isKeyStep(head) && n.node.Kind == yaml.MappingNode {
+		if _, err := n.tree.findKey(n.node, head, true); err != nil {
+			return nil, err
+		}
+	}
+
 	childNode, keyFound, incompatibleKind := n.get(head)
 	if incompatibleKind {
 		if forbidKindChange {
@@ -468,7 +613,8 @@ func (n *node) setAt(path Path, value interface{}, forbidKindChange bool) (Node,
 			return nil, err
 		}
 
-		deepCopyNode(n.node, *newEmptyNode)
+		n.tree.keyIndex().removed(n.node)
+		shallowCopyNode(n.node, *newEmptyNode)
 
 		// the key cannot possibly exist now
 		keyFound = false
@@ -485,7 +631,7 @@ func (n *node) setAt(path Path, value interface{}, forbidKindChange bool) (Node,
 			return nil, err
 		}
 
-		childNode = &node{newEmptyNode}
+		childNode = n.child(newEmptyNode)
 	}
 
 	childAsserted, ok := childNode.(*node)
@@ -493,7 +639,7 @@ func (n *node) setAt(path Path, value interface{}, forbidKindChange bool) (Node,
 		panic("This should never happen.")
 	}
 
-	return childAsserted.setAt(tail, value, forbidKindChange)
+	return childAsserted.setPath(tail, value, forbidKindChange)
 }
 
 /////////////////////////////////////////////////////////////////////
@@ -504,49 +650,38 @@ func (n *node) DeleteKey(steps ...Step) error {
 		return errors.New("path cannot be empty")
 	}
 
+	return n.tree.changeAt(n.node, steps, changeRemoving, func() error {
+		return n.deleteKey(steps)
+	})
+}
+
+func (n *node) deleteKey(steps Path) error {
 	if len(steps) > 1 {
 		// re-use the existing recursion helper in Get()
 		// to get to the node right before the last step.
 		headPath := steps[:len(steps)-1]
 
-		node, exists := n.Get(headPath...)
+		parent, exists := n.Get(headPath...)
 		if !exists {
 			return nil
 		}
 
 		// and then recurse to actually remove the  key
-		return node.DeleteKey(steps[len(steps)-1])
+		return parent.(*node).deleteKey(steps[len(steps)-1:])
 	}
 
 	switch step := steps[0].(type) {
-	// string means we remove a key from an object (mapping)
-	case string:
+	// string (or a typed key) means we remove a key from an object (mapping)
+	case string, KeyStep:
 		if n.node.Kind != yaml.MappingNode {
 			return nil
 		}
 
 		// mappings are represented as [keyNode, valueNode, keyNode, valueNode, ...]
 		// in this node's content
-		keyIndex := -1
-
-		for i := 0; i < len(n.node.Content); i += 2 {
-			keyNode := n.node.Content[i]
-
-			// safety check
-			if keyNode.Kind != yaml.ScalarNode {
-				continue
-			}
-
-			// we found the key! next content item will be the value
-			if keyNode.Value == step {
-				// safety check
-				if i+1 >= len(n.node.Content) {
-					return nil
-				}
-
-				keyIndex = i
-				break
-			}
+		keyIndex, err := n.tree.findKey(n.node, step, true)
+		if err != nil {
+			return err
 		}
 
 		// key not found
@@ -555,6 +690,8 @@ func (n *node) DeleteKey(steps ...Step) error {
 		}
 
 		// remove the key node and the value node
+		n.tree.keyIndex().invalidate(n.node)
+		n.tree.keyIndex().removed(n.node.Content[keyIndex+1])
 		n.node.Content = append(n.node.Content[:keyIndex], n.node.Content[keyIndex+2:]...)
 
 		// success
@@ -567,16 +704,39 @@ func (n *node) DeleteKey(steps ...Step) error {
 			return nil
 		}
 
-		if step >= len(n.node.Content) {
+		step = sequenceIndex(n.node, step)
+		if step < 0 || step >= len(n.node.Content) {
 			return nil
 		}
 
 		// remove the array item
+		n.tree.keyIndex().removed(n.node.Content[step])
 		n.node.Content = append(n.node.Content[:step], n.node.Content[step+1:]...)
 
 		// success!
 		return nil
 
+	// there is nothing after the last item to remove
+	case AppendStep:
+		return nil
+
+	// a matcher removes the first matching array item
+	case MatchStep:
+		if n.node.Kind != yaml.SequenceNode {
+			return nil
+		}
+
+		i := step.index(n.node)
+		if i < 0 {
+			return nil
+		}
+
+		n.tree.keyIndex().removed(n.node.Content[i])
+		n.node.Content = append(n.node.Content[:i], n.node.Content[i+1:]...)
+
+		// success!
+		return nil
+
 	default:
 		return fmt.Errorf("cannot handle %T steps", step)
 	}
@@ -667,10 +827,10 @@ func createFittingEmptyNode(s Step) (*yaml.Node, error) {
 	}
 
 	switch s.(type) {
-	case string:
+	case string, KeyStep:
 		return mappingNode(), nil
 
-	case int:
+	case int, AppendStep, MatchStep:
 		return sequenceNode(), nil
 
 	default:
@@ -678,6 +838,16 @@ func createFittingEmptyNode(s Step) (*yaml.Node, error) {
 	}
 }
 
+// sequenceIndex turns negative indexes, which count from the end of the
+// sequence, into regular ones. The result can still be out of range.
+func sequenceIndex(sequence *yaml.Node, index int) int {
+	if index < 0 {
+		return len(sequence.Content) + index
+	}
+
+	return index
+}
+
 func createNode(value interface{}) (*yaml.Node, error) {
 	var buf bytes.Buffer
 	if err := yaml.NewEncoder(&buf).Encode(value); err != nil {
@@ -697,7 +867,9 @@ func createNode(value interface{}) (*yaml.Node, error) {
 	return node.Content[0], nil
 }
 
-func deepCopyNode(dst *yaml.Node, src yaml.Node) {
+// shallowCopyNode overwrites dst with the fields of src. The Content
+// slice is shared between both nodes; use cloneNode() for a deep copy.
+func shallowCopyNode(dst *yaml.Node, src yaml.Node) {
 	dst.Kind = src.Kind
 	dst.Style = src.Style
 	dst.Tag = src.Tag
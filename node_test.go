@@ -357,3 +357,52 @@ foo:
   # new head comment
 `)
 }
+
+func TestNodeRelativeIndexes(t *testing.T) {
+	input := strings.TrimSpace(`
+list: [a, b, c]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if last := doc.MustGet("list", -1).ToString(); last != "c" {
+		t.Fatalf("Expected last item to be c, but got %q.", last)
+	}
+
+	if _, ok := doc.Get("list", -4); ok {
+		t.Fatal("Expected index -4 to be out of range.")
+	}
+
+	if _, ok := doc.Get("list", End); ok {
+		t.Fatal("Expected End to never exist.")
+	}
+
+	if _, err := doc.SetAt(Path{"list", -2}, "B"); err != nil {
+		t.Fatalf("Failed to set item: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"list", End}, "d"); err != nil {
+		t.Fatalf("Failed to append item: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"new", End, "name"}, "first"); err != nil {
+		t.Fatalf("Failed to append to missing list: %v", err)
+	}
+
+	if err := doc.DeleteKey("list", -4); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	expectYAML(t, node, `
+list: [B, c, d]
+new:
+  - name: first
+`)
+
+	if _, err := doc.SetAt(Path{"list", -10}, "x"); err == nil {
+		t.Fatal("Expected out of range index to be rejected.")
+	}
+}
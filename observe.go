@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+)
+
+type ChangeKind int
+
+const (
+	// ChangeReplace means an existing node was changed.
+	ChangeReplace ChangeKind = iota
+	// ChangeInsert means a new mapping key or sequence item was added.
+	ChangeInsert
+	// ChangeRemove means a mapping key or sequence item was removed.
+	ChangeRemove
+	// ChangeComment means a comment on the document, a node or a key
+	// was changed.
+	ChangeComment
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeReplace:
+		return "replace"
+	case ChangeInsert:
+		return "insert"
+	case ChangeRemove:
+		return "remove"
+	case ChangeComment:
+		return "comment"
+	default:
+		return fmt.Sprintf("?ChangeKind(%d)?", int(k))
+	}
+}
+
+// Change describes a single modification of a Document. The nodes
+// are copies and must not be modified.
+type Change struct {
+	Kind ChangeKind
+	Path Path
+
+	// Old is nil for insertions, New is nil for removals; both are
+	// nil for comment changes.
+	Old Node
+	New Node
+
+	// Path is nil for comments on the document itself. If OnKey is
+	// true, the comment is on the key of the mapping entry at Path.
+	OnKey      bool
+	Position   CommentPosition
+	OldComment string
+	NewComment string
+}
+
+// ObserverFunc is called for every change of a Document. Returning an
+// error vetoes the change: it is reverted and the error is returned to
+// the caller of the modifying function. Changes to comments cannot
+// be vetoed, as the comment setters do not return errors; they are
+// reverted silently instead.
+// Observers are also notified when changes are reverted (by a
+// rollback, Undo(), or the veto of another observer) or redone, but
+// cannot veto those.
+type ObserverFunc func(change Change) error
+
+type observer struct {
+	fn ObserverFunc
+}
+
+func (d *document) Observe(fn ObserverFunc) (remove func()) {
+	o := &observer{fn: fn}
+	d.observers = append(d.observers, o)
+
+	return func() {
+		for i, registered := range d.observers {
+			if registered == o {
+				d.observers = append(d.observers[:i:i], d.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify informs all observers about the operations, which have
+// already been applied. If an observer vetoes, all operations are
+// reverted and the observer's error is returned.
+func (d *document) notify(ops []operation) error {
+	// copy the list, so observers can remove themselves
+	observers := append([]*observer{}, d.observers...)
+
+	for i, op := range ops {
+		change := op.change()
+
+		for j, o := range observers {
+			err := o.fn(change)
+			if err == nil {
+				continue
+			}
+
+			// revert the operations nobody has been notified about yet
+			for k := len(ops) - 1; k > i; k-- {
+				if revertErr := d.apply(ops[k], true); revertErr != nil {
+					return fmt.Errorf("%w (additionally, reverting the change failed: %v)", err, revertErr)
+				}
+			}
+
+			// revert the vetoed operation and tell everyone who has
+			// been notified about it before
+			if revertErr := d.apply(op, true); revertErr != nil {
+				return fmt.Errorf("%w (additionally, reverting the change failed: %v)", err, revertErr)
+			}
+
+			reverted := op.inverse().change()
+			for _, notified := range observers[:j] {
+				_ = notified.fn(reverted)
+			}
+
+			if revertErr := d.revert(ops[:i]); revertErr != nil {
+				return fmt.Errorf("%w (additionally, reverting the change failed: %v)", err, revertErr)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifyApplied informs all observers about an operation that has
+// been re-applied.
+func (d *document) notifyApplied(op operation) {
+	if len(d.observers) == 0 {
+		return
+	}
+
+	change := op.change()
+	for _, o := range append([]*observer{}, d.observers...) {
+		_ = o.fn(change)
+	}
+}
+
+// notifyReverted informs all observers about an operation that has
+// been reverted.
+func (d *document) notifyReverted(op operation) {
+	if len(d.observers) > 0 {
+		d.notifyApplied(op.inverse())
+	}
+}
+
+// inverse returns the operation that undoes op.
+func (op operation) inverse() operation {
+	inverted := op
+	inverted.oldValue, inverted.newValue = op.newValue, op.oldValue
+	inverted.oldComment, inverted.newComment = op.newComment, op.oldComment
+
+	switch op.kind {
+	case opInsert:
+		inverted.kind = opRemove
+	case opRemove:
+		inverted.kind = opInsert
+	}
+
+	return inverted
+}
+
+func (op operation) change() Change {
+	change := Change{
+		Path:       copyPath(op.path),
+		OldComment: op.oldComment,
+		NewComment: op.newComment,
+	}
+
+	switch op.kind {
+	case opReplace:
+		change.Kind = ChangeReplace
+	case opInsert:
+		change.Kind = ChangeInsert
+	case opRemove:
+		change.Kind = ChangeRemove
+	case opComment:
+		change.Kind = ChangeComment
+		change.OnKey = op.owner == commentOnKey
+		change.Position = op.comment
+
+		if op.owner == commentOnDocument {
+			change.Path = nil
+		}
+	}
+
+	if op.oldValue != nil {
+		change.Old = &node{node: op.oldValue}
+	}
+
+	if op.newValue != nil {
+		change.New = &node{node: op.newValue}
+	}
+
+	return change
+}
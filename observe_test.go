@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func describeChange(c Change) string {
+	switch c.Kind {
+	case ChangeComment:
+		return fmt.Sprintf("%v: %q -> %q", c.Kind, c.OldComment, c.NewComment)
+	case ChangeInsert:
+		return fmt.Sprintf("%v %v: %s", c.Kind, c.Path, c.New.ToString())
+	case ChangeRemove:
+		return fmt.Sprintf("%v %v: %s", c.Kind, c.Path, c.Old.ToString())
+	default:
+		return fmt.Sprintf("%v %v: %s -> %s", c.Kind, c.Path, c.Old.ToString(), c.New.ToString())
+	}
+}
+
+func TestObserve(t *testing.T) {
+	input := strings.TrimSpace(`
+name: web
+list: [a, b]
+`)
+
+	_, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var changes []string
+	remove := doc.Observe(func(c Change) error {
+		changes = append(changes, describeChange(c))
+		return nil
+	})
+
+	if _, err := doc.SetKey("name", "api"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if _, err := doc.SetKey("name", "api"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"list", 2}, "c"); err != nil {
+		t.Fatalf("Failed to set path: %v", err)
+	}
+
+	if err := doc.DeleteKey("list", 0); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	doc.SetHeadComment("hello")
+
+	remove()
+
+	if _, err := doc.SetKey("name", "ignored"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	expected := []string{
+		"replace name: web -> api",
+		"insert list.[2]: c",
+		"remove list.[0]: a",
+		`comment: "" -> "hello"`,
+	}
+
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected changes\n\n%s\n\nbut got\n\n%s", strings.Join(expected, "\n"), strings.Join(changes, "\n"))
+	}
+}
+
+func TestObserveVeto(t *testing.T) {
+	input := strings.TrimSpace(`
+name: web
+list: [a, b]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var changes []string
+	doc.Observe(func(c Change) error {
+		changes = append(changes, describeChange(c))
+		return nil
+	})
+
+	forbidden := errors.New("list is read-only")
+	doc.Observe(func(c Change) error {
+		if len(c.Path) > 0 && c.Path[0] == "list" {
+			return forbidden
+		}
+
+		return nil
+	})
+
+	if _, err := doc.SetAt(Path{"list", 4}, "e"); !errors.Is(err, forbidden) {
+		t.Fatalf("Expected change to be vetoed, but got %v.", err)
+	}
+
+	if err := doc.DeleteKey("list", 1); !errors.Is(err, forbidden) {
+		t.Fatalf("Expected change to be vetoed, but got %v.", err)
+	}
+
+	if _, err := doc.SetKey("name", "api"); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	expectYAML(t, node, `
+name: api
+list: [a, b]
+`)
+
+	expected := []string{
+		"insert list.[2]: ",
+		"remove list.[2]: ",
+		"remove list.[1]: b",
+		"insert list.[1]: b",
+		"replace name: web -> api",
+	}
+
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected changes\n\n%s\n\nbut got\n\n%s", strings.Join(expected, "\n"), strings.Join(changes, "\n"))
+	}
+}
+
+func TestObserveNodeChanges(t *testing.T) {
+	input := strings.TrimSpace(`
+spec:
+  replicas: 1
+  ports: [80, 443]
+`)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	var changes []string
+	doc.Observe(func(c Change) error {
+		changes = append(changes, describeChange(c))
+
+		if c.Kind == ChangeRemove {
+			return errors.New("no removals")
+		}
+
+		return nil
+	})
+
+	spec := doc.MustGet("spec")
+
+	if _, err := spec.SetKey("replicas", 3); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	if err := spec.DeleteKey("ports", 0); err == nil {
+		t.Fatal("Expected the removal to be vetoed.")
+	}
+
+	expected := []string{
+		"replace spec.replicas: 1 -> 3",
+		"remove spec.ports.[0]: 80",
+	}
+
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected changes\n%v\n\nbut got\n%v", expected, changes)
+	}
+
+	expectYAML(t, node, `
+spec:
+  replicas: 3
+  ports: [80, 443]
+`)
+}
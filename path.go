@@ -4,7 +4,9 @@
 package yamled
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -12,6 +14,15 @@ type Step interface{}
 
 type Path []Step
 
+// AppendStep is the type of End.
+type AppendStep struct{}
+
+// End is a path step that refers to the position after the last item
+// of a sequence, so that SetAt(Path{"items", End}, value) appends a
+// new item. When reading, End never matches anything. Negative int
+// steps count from the end of a sequence, so -1 is its last item.
+var End = AppendStep{}
+
 func (p Path) Append(s ...Step) Path {
 	return append(p, s...)
 }
@@ -67,6 +78,17 @@ func (p Path) String() string {
 			continue
 		}
 
+		if _, ok := p.(AppendStep); ok {
+			parts = append(parts, "[-]")
+			continue
+		}
+
+		// matchers are rendered like "containers[name=web]"
+		if m, ok := p.(MatchStep); ok && len(parts) > 0 {
+			parts[len(parts)-1] += m.String()
+			continue
+		}
+
 		parts = append(parts, fmt.Sprintf("%v", p))
 	}
 
@@ -78,11 +100,19 @@ func (p Path) Validate() error {
 
 	for _, s := range p {
 		switch step := s.(type) {
-		case string:
+		case string, int, AppendStep:
 			// NOP
-		case int:
-			if step < 0 {
-				errors = append(errors, fmt.Sprintf("%d is invalid, steps must be >= 0", step))
+		case MatchStep:
+			if step.err != nil {
+				errors = append(errors, step.err.Error())
+			} else if step.value == nil {
+				errors = append(errors, "empty MatchStep, use Where() to create one")
+			}
+		case KeyStep:
+			if step.err != nil {
+				errors = append(errors, step.err.Error())
+			} else if step.node == nil {
+				errors = append(errors, "empty KeyStep, use Key() to create one")
 			}
 		default:
 			errors = append(errors, fmt.Sprintf("cannot handle %T steps", step))
@@ -95,3 +125,141 @@ func (p Path) Validate() error {
 
 	return nil
 }
+
+// ParsePath parses a path in the form of "foo.bar[0].baz". Keys that
+// contain dots or brackets can be quoted, like `foo["example.com/key"]`.
+// For compatibility with String(), indexes may also be separated by
+// dots, like "foo.[0]". Negative indexes count from the end and "[-]"
+// is parsed as End. Sequence items can be selected by a field's value
+// like "containers[name=web]", which is parsed as Where("name", "web").
+func ParsePath(s string) (Path, error) {
+	path := Path{}
+	pos := 0
+
+	for pos < len(s) {
+		switch s[pos] {
+		case '.':
+			pos++
+
+			// a trailing dot or two consecutive dots are an error
+			if pos >= len(s) || s[pos] == '.' {
+				return nil, fmt.Errorf("invalid path %q: empty key at position %d", s, pos)
+			}
+
+		case '[':
+			end := indexUnquoted(s[pos:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated [ at position %d", s, pos)
+			}
+
+			inner := s[pos+1 : pos+end]
+			pos += end + 1
+
+			if inner == "-" {
+				path = append(path, End)
+				continue
+			}
+
+			if eq := indexUnquoted(inner, '='); eq >= 0 {
+				step, err := parseMatchStep(inner[:eq], inner[eq+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: %w", s, err)
+				}
+
+				path = append(path, step)
+				continue
+			}
+
+			if strings.HasPrefix(inner, `"`) {
+				key, rest, err := unquoteKey(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: %w", s, err)
+				}
+
+				if rest != "" {
+					return nil, fmt.Errorf("invalid path %q: expected ] after quoted key", s)
+				}
+
+				path = append(path, key)
+				continue
+			}
+
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: invalid index %q", s, inner)
+			}
+
+			path = append(path, index)
+
+		default:
+			end := strings.IndexAny(s[pos:], ".[")
+			if end < 0 {
+				end = len(s) - pos
+			}
+
+			path = append(path, s[pos:pos+end])
+			pos += end
+		}
+	}
+
+	return path, nil
+}
+
+func parseMatchStep(field string, value string) (MatchStep, error) {
+	var err error
+
+	if strings.HasPrefix(field, `"`) {
+		if field, err = strconv.Unquote(field); err != nil {
+			return MatchStep{}, fmt.Errorf("invalid quoted field %s", field)
+		}
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		if value, err = strconv.Unquote(value); err != nil {
+			return MatchStep{}, fmt.Errorf("invalid quoted value %s", value)
+		}
+	}
+
+	if field == "" {
+		return MatchStep{}, errors.New("matcher field cannot be empty")
+	}
+
+	return Where(field, value), nil
+}
+
+// indexUnquoted returns the position of the first c in s that is not
+// part of a double-quoted string, or -1.
+func indexUnquoted(s string, c byte) int {
+	quoted := false
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == c:
+			return i
+		}
+	}
+
+	return -1
+}
+
+func unquoteKey(s string) (string, string, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			key, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid quoted key %s", s[:i+1])
+			}
+
+			return key, s[i+1:], nil
+		}
+	}
+
+	return "", "", errors.New("unterminated quoted key")
+}
@@ -40,3 +40,78 @@ func TestPathEnd(t *testing.T) {
 		t.Errorf("end of [a b c] should be a, but is %v", end)
 	}
 }
+
+func TestParsePath(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected Path
+	}{
+		{input: "", expected: Path{}},
+		{input: "foo", expected: Path{"foo"}},
+		{input: ".foo", expected: Path{"foo"}},
+		{input: "foo.bar", expected: Path{"foo", "bar"}},
+		{input: "foo[1].bar", expected: Path{"foo", 1, "bar"}},
+		{input: "foo.[1].bar", expected: Path{"foo", 1, "bar"}},
+		{input: "[0][1]", expected: Path{0, 1}},
+		{input: `metadata.labels["example.com/name"]`, expected: Path{"metadata", "labels", "example.com/name"}},
+		{input: `foo["say \"hi\""]`, expected: Path{"foo", `say "hi"`}},
+		{input: "items[-1].name", expected: Path{"items", -1, "name"}},
+		{input: "items[-]", expected: Path{"items", End}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.input, func(t *testing.T) {
+			parsed, err := ParsePath(tc.input)
+			if err != nil {
+				t.Fatalf("Failed to parse path: %v", err)
+			}
+
+			assertPath(t, parsed, tc.expected)
+		})
+	}
+}
+
+func TestParseInvalidPath(t *testing.T) {
+	for _, input := range []string{"foo.", "foo..bar", "foo[", "foo[bar]", `foo["bar]`, `foo["bar"x]`} {
+		if _, err := ParsePath(input); err == nil {
+			t.Errorf("Should not have been able to parse %q.", input)
+		}
+	}
+}
+
+func TestParsePathRoundtrip(t *testing.T) {
+	path := Path{"foo", 1, "bar", -1, End}
+
+	parsed, err := ParsePath(path.String())
+	if err != nil {
+		t.Fatalf("Failed to parse path: %v", err)
+	}
+
+	assertPath(t, parsed, path)
+}
+
+func TestParsePathMatchStepRoundtrip(t *testing.T) {
+	for _, step := range []MatchStep{
+		Where("name", "web"),
+		Where("name", "a]b"),
+		Where("name", `say "hi"`),
+		Where("name", "k=v"),
+		Where("app.kubernetes.io/name", "[x]"),
+	} {
+		path := Path{"containers", step, "image"}
+
+		parsed, err := ParsePath(path.String())
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", path.String(), err)
+		}
+
+		if len(parsed) != 3 || parsed.String() != path.String() {
+			t.Fatalf("Expected %q, but got %q.", path.String(), parsed.String())
+		}
+
+		match, ok := parsed[1].(MatchStep)
+		if !ok || match.Field() != step.Field() {
+			t.Fatalf("Expected matcher for field %q, but got %#v.", step.Field(), parsed[1])
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadOnlyDirective is the comment that marks a node (including all
+// of its children) as read-only, if protection is enabled.
+const ReadOnlyDirective = "yamled:readonly"
+
+var readOnlyDirective = regexp.MustCompile(`(^|\n)#\s*` + regexp.QuoteMeta(ReadOnlyDirective) + `(\s|$)`)
+
+// ReadOnlyError is returned when a change would modify a protected
+// node.
+type ReadOnlyError struct {
+	// Path is the protected path that would have been modified.
+	Path Path
+	// Pattern is the pattern that protects the path; it is empty if
+	// the node is protected by a comment directive.
+	Pattern string
+}
+
+func (e *ReadOnlyError) Error() string {
+	if e.Pattern == "" {
+		return fmt.Sprintf("%v is read-only (marked with %q)", e.Path, ReadOnlyDirective)
+	}
+
+	return fmt.Sprintf("%v is read-only (protected by %q)", e.Path, e.Pattern)
+}
+
+type protection struct {
+	patterns []protectionPattern
+}
+
+type protectionPattern struct {
+	source string
+	steps  Path
+}
+
+func (p *protection) clone() *protection {
+	if p == nil {
+		return nil
+	}
+
+	return &protection{
+		patterns: append([]protectionPattern{}, p.patterns...),
+	}
+}
+
+// Protect enables read-only protection and marks all paths matching
+// the given glob patterns as read-only. Patterns use the same syntax
+// as ParsePath(), plus "*" for any single step (a "*" within a key
+// matches any characters) and "**" for any number of steps, like
+// "metadata.uid" or "spec.containers.*.image". Once protection is
+// enabled, all nodes with a "# yamled:readonly" comment are read-only
+// as well, so Protect() can be called without patterns to only
+// enable the directive.
+// Changes through the Document API that would modify a read-only node
+// or any of its children fail with a *ReadOnlyError. Changing or
+// removing a "# yamled:readonly" comment is rejected as well; as the
+// comment setters cannot return an error, such changes are reverted.
+func (d *document) Protect(patterns ...string) error {
+	parsed := make([]protectionPattern, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		steps, err := ParsePath(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+
+		parsed = append(parsed, protectionPattern{
+			source: pattern,
+			steps:  steps,
+		})
+	}
+
+	if d.protection == nil {
+		d.protection = &protection{}
+	}
+
+	d.protection.patterns = append(d.protection.patterns, parsed...)
+
+	return nil
+}
+
+// Unprotect disables read-only protection and forgets all patterns.
+func (d *document) Unprotect() {
+	d.protection = nil
+}
+
+// IsReadOnly returns true if the given path is protected, either by a
+// pattern or by a directive on the node or one of its parents.
+func (d *document) IsReadOnly(path Path) bool {
+	return d.readOnly(path) != nil
+}
+
+// readOnly returns a *ReadOnlyError if the given path is protected.
+func (d *document) readOnly(path Path) error {
+	if d.protection == nil {
+		return nil
+	}
+
+	current := d.node.Content[0]
+
+	for i := 0; i <= len(path); i++ {
+		if pattern := d.protection.match(path[:i]); pattern != "" {
+			return &ReadOnlyError{Path: copyPath(path[:i]), Pattern: pattern}
+		}
+
+		if current == nil {
+			continue
+		}
+
+		var key *yaml.Node
+		if i > 0 {
+			key, current = childNodes(current, path[i-1])
+			if current == nil {
+				continue
+			}
+		}
+
+		if hasReadOnlyDirective(key, current) {
+			return &ReadOnlyError{Path: copyPath(path[:i])}
+		}
+	}
+
+	return nil
+}
+
+// checkProtection returns an error if any of the operations modifies
+// a read-only node.
+func (d *document) checkProtection(ops []operation) error {
+	if d.protection == nil {
+		return nil
+	}
+
+	for _, op := range ops {
+		check := d.checkOperation
+		if op.kind == opComment {
+			check = d.checkComment
+		}
+
+		if err := check(op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkComment returns an error if the comment change removes or alters
+// a read-only directive, which would lift the node's protection.
+func (d *document) checkComment(op operation) error {
+	if op.owner == commentOnDocument || op.oldComment == op.newComment {
+		return nil
+	}
+
+	if readOnlyDirective.MatchString(op.oldComment) {
+		return &ReadOnlyError{Path: copyPath(op.path)}
+	}
+
+	return nil
+}
+
+func (d *document) checkOperation(op operation) error {
+	// the operation must not happen inside of a protected subtree;
+	// the parents of the changed node are not modified and so can be
+	// checked in the current document
+	current := d.node.Content[0]
+
+	for i := 0; i < len(op.path); i++ {
+		if pattern := d.protection.match(op.path[:i]); pattern != "" {
+			return &ReadOnlyError{Path: copyPath(op.path[:i]), Pattern: pattern}
+		}
+
+		var key *yaml.Node
+		if i > 0 {
+			key, current = childNodes(current, op.path[i-1])
+			if current == nil {
+				break
+			}
+		}
+
+		if hasReadOnlyDirective(key, current) {
+			return &ReadOnlyError{Path: copyPath(op.path[:i])}
+		}
+	}
+
+	if pattern := d.protection.match(op.path); pattern != "" {
+		return &ReadOnlyError{Path: copyPath(op.path), Pattern: pattern}
+	}
+
+	if op.oldValue == nil {
+		return nil
+	}
+
+	// the changed node itself and all of its children
+	key := op.key
+	if op.kind == opReplace && len(op.path) > 0 {
+		parent := lookupPath(d.node.Content[0], op.path.Parent())
+		if parent != nil {
+			key, _ = childNodes(parent, op.path.End())
+		}
+	}
+
+	if hasReadOnlyDirective(key, op.oldValue) {
+		return &ReadOnlyError{Path: copyPath(op.path)}
+	}
+
+	return d.checkChildren(copyPath(op.path), op.oldValue, op.newValue)
+}
+
+// checkChildren walks the old value and returns an error if a
+// protected child was changed or removed.
+func (d *document) checkChildren(path Path, oldValue *yaml.Node, newValue *yaml.Node) error {
+	check := func(step Step, key *yaml.Node, oldChild *yaml.Node) error {
+		childPath := append(copyPath(path), step)
+
+		var newChild *yaml.Node
+		if newValue != nil {
+			_, newChild = childNodes(newValue, step)
+		}
+
+		pattern := d.protection.match(childPath)
+		if pattern != "" || hasReadOnlyDirective(key, oldChild) {
+			if newChild == nil || !Equal(&node{node: oldChild}, &node{node: newChild}, EqualOptions{}) {
+				return &ReadOnlyError{Path: childPath, Pattern: pattern}
+			}
+
+			return nil
+		}
+
+		return d.checkChildren(childPath, oldChild, newChild)
+	}
+
+	switch oldValue.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(oldValue.Content); i += 2 {
+			key := oldValue.Content[i]
+
+			if err := check(keyStep(key), key, oldValue.Content[i+1]); err != nil {
+				return err
+			}
+		}
+
+	case yaml.SequenceNode:
+		for i, item := range oldValue.Content {
+			if err := check(i, nil, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// match returns the first pattern that matches the path.
+func (p *protection) match(path Path) string {
+	for _, pattern := range p.patterns {
+		if matchPattern(pattern.steps, path) {
+			return pattern.source
+		}
+	}
+
+	return ""
+}
+
+func matchPattern(pattern Path, path Path) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPattern(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(path) == 0 || !matchStep(pattern[0], path[0]) {
+		return false
+	}
+
+	return matchPattern(pattern[1:], path[1:])
+}
+
+func matchStep(pattern Step, step Step) bool {
+	switch p := pattern.(type) {
+	case int:
+		s, ok := step.(int)
+		return ok && s == p
+
+	case string:
+		if p == "*" {
+			return true
+		}
+
+		s, ok := step.(string)
+		return ok && matchWildcard(p, s)
+
+	default:
+		return false
+	}
+}
+
+// matchWildcard matches s against a pattern where "*" matches any
+// number of characters.
+func matchWildcard(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			for i := 0; i <= len(s); i++ {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(s) == 0 || s[0] != pattern[0] {
+			return false
+		}
+
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return len(s) == 0
+}
+
+// childNodes returns the key node (nil for sequences) and the value
+// node for the given step.
+func childNodes(n *yaml.Node, step Step) (*yaml.Node, *yaml.Node) {
+	index := childIndex(n, step)
+	if index < 0 {
+		return nil, nil
+	}
+
+	if n.Kind == yaml.MappingNode {
+		return n.Content[index], n.Content[index+1]
+	}
+
+	return nil, n.Content[index]
+}
+
+func hasReadOnlyDirective(nodes ...*yaml.Node) bool {
+	for _, n := range nodes {
+		if n != nil && (readOnlyDirective.MatchString(n.HeadComment) || readOnlyDirective.MatchString(n.LineComment)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,293 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const protectTestInput = `
+metadata:
+  name: web
+  uid: 1234
+spec:
+  containers:
+    - name: app
+      image: app:v1
+  # yamled:readonly
+  generated:
+    checksum: abc
+  tags: [a, b] # yamled:readonly
+`
+
+func expectReadOnlyError(t *testing.T, err error, expectedPath string) {
+	t.Helper()
+
+	var roErr *ReadOnlyError
+	if !errors.As(err, &roErr) {
+		t.Fatalf("Expected ReadOnlyError, but got %v.", err)
+	}
+
+	if roErr.Path.String() != expectedPath {
+		t.Fatalf("Expected error for %q, but got %q.", expectedPath, roErr.Path.String())
+	}
+}
+
+func TestProtectPatterns(t *testing.T) {
+	input := strings.TrimSpace(protectTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.Protect("metadata.uid", "spec.containers.*.image", "status.**"); err != nil {
+		t.Fatalf("Failed to protect paths: %v", err)
+	}
+
+	_, err = doc.SetAt(Path{"metadata", "uid"}, 5678)
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	_, err = doc.SetAt(Path{"spec", "containers", 0, "image"}, "app:v2")
+	expectReadOnlyError(t, err, "spec.containers.[0].image")
+
+	err = doc.DeleteKey("metadata")
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	_, err = doc.SetAt(Path{"status", "ready"}, true)
+	expectReadOnlyError(t, err, "status")
+
+	_, err = doc.ReplaceKey("metadata", map[string]string{"name": "web"})
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	// setting a parent to an equal value is fine
+	root, err := doc.RootNode()
+	if err != nil {
+		t.Fatalf("Failed to get root node: %v", err)
+	}
+
+	if err := doc.UpdateFrom(root.ToMap()); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	if _, err := doc.SetAt(Path{"metadata", "name"}, "api"); err != nil {
+		t.Fatalf("Failed to set unprotected path: %v", err)
+	}
+
+	if !doc.IsReadOnly(Path{"status", "ready"}) {
+		t.Fatal("Expected status.ready to be read-only.")
+	}
+
+	if doc.IsReadOnly(Path{"metadata", "name"}) {
+		t.Fatal("Expected metadata.name not to be read-only.")
+	}
+
+	expectYAML(t, node, strings.Replace(input, "name: web", "name: api", 1))
+}
+
+func TestProtectDirective(t *testing.T) {
+	input := strings.TrimSpace(protectTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	// directives are ignored unless protection is enabled
+	if doc.IsReadOnly(Path{"spec", "generated"}) {
+		t.Fatal("Expected directive to be ignored.")
+	}
+
+	if err := doc.Protect(); err != nil {
+		t.Fatalf("Failed to enable protection: %v", err)
+	}
+
+	_, err = doc.SetAt(Path{"spec", "generated", "checksum"}, "def")
+	expectReadOnlyError(t, err, "spec.generated")
+
+	_, err = doc.SetAt(Path{"spec", "generated", "new"}, "def")
+	expectReadOnlyError(t, err, "spec.generated")
+
+	err = doc.DeleteKey("spec", "tags", 0)
+	expectReadOnlyError(t, err, "spec.tags")
+
+	err = doc.DeleteKey("spec")
+	expectReadOnlyError(t, err, "spec.generated")
+
+	err = doc.Transaction(func(tx Tx) error {
+		if _, err := tx.SetAt(Path{"metadata", "name"}, "api"); err != nil {
+			return err
+		}
+
+		return tx.DeleteKey("spec", "generated")
+	})
+	expectReadOnlyError(t, err, "spec.generated")
+
+	expectYAML(t, node, input)
+
+	doc.Unprotect()
+
+	if err := doc.DeleteKey("spec", "generated"); err != nil {
+		t.Fatalf("Failed to delete unprotected key: %v", err)
+	}
+}
+
+func TestProtectBeforeChange(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(protectTestInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.Protect("metadata"); err != nil {
+		t.Fatalf("Failed to protect: %v", err)
+	}
+
+	metadata := doc.MustGet("metadata")
+
+	_, err = doc.SetAt(Path{"metadata"}, map[string]string{"name": "api"})
+	expectReadOnlyError(t, err, "metadata")
+
+	// the node was never replaced (and restored), so it is still part
+	// of the document
+	if rawNode(metadata) != rawNode(doc.MustGet("metadata")) {
+		t.Fatal("Expected the original node to be kept.")
+	}
+}
+
+func TestProtectEdit(t *testing.T) {
+	input := strings.TrimSpace(protectTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.Protect("metadata.uid"); err != nil {
+		t.Fatalf("Failed to protect: %v", err)
+	}
+
+	err = doc.Edit(nil, func(root *yaml.Node) error {
+		root.Content[1].Content[3].Value = "5678"
+		return nil
+	})
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	// the rejected change was reverted
+	expectYAML(t, node, input)
+
+	if err := doc.Edit(Path{"metadata"}, func(metadata *yaml.Node) error {
+		metadata.Content[1].Value = "api"
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to edit unprotected node: %v", err)
+	}
+
+	if name := doc.MustGet("metadata", "name").ToString(); name != "api" {
+		t.Fatalf("Expected name to be api, but got %q.", name)
+	}
+}
+
+func TestProtectNodeChanges(t *testing.T) {
+	input := strings.TrimSpace(protectTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.Protect("metadata.uid"); err != nil {
+		t.Fatalf("Failed to protect: %v", err)
+	}
+
+	metadata := doc.MustGet("metadata")
+
+	err = metadata.DeleteKey("uid")
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	_, err = metadata.SetKey("uid", 5678)
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	err = metadata.Replace(map[string]string{"name": "web"})
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	err = doc.MustGet("metadata", "uid").Set(5678)
+	expectReadOnlyError(t, err, "metadata.uid")
+
+	expectYAML(t, node, input)
+
+	if _, err := metadata.SetKey("name", "api"); err != nil {
+		t.Fatalf("Failed to set unprotected key: %v", err)
+	}
+}
+
+func TestProtectDirectiveComments(t *testing.T) {
+	input := strings.TrimSpace(protectTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.Protect(); err != nil {
+		t.Fatalf("Failed to protect: %v", err)
+	}
+
+	// removing or changing the directives must be reverted
+	doc.MustGet("spec", "tags").SetLineComment("")
+
+	generated, _ := doc.GetKey("spec", "generated")
+	generated.SetHeadComment("# generated")
+
+	doc.MustGet("spec").StripComments()
+
+	expectYAML(t, node, input)
+
+	_, err = doc.SetAt(Path{"spec", "tags", 0}, "c")
+	expectReadOnlyError(t, err, "spec.tags")
+
+	_, err = doc.SetAt(Path{"spec", "generated", "checksum"}, "def")
+	expectReadOnlyError(t, err, "spec.generated")
+
+	// other comments can still be changed
+	doc.MustGet("metadata", "uid").SetLineComment("# assigned by the server")
+
+	expected := strings.Replace(input, "uid: 1234", "uid: 1234 # assigned by the server", 1)
+	expectYAML(t, node, expected)
+}
+
+func TestMatchPattern(t *testing.T) {
+	testcases := []struct {
+		pattern  string
+		path     Path
+		expected bool
+	}{
+		{pattern: "a.b", path: Path{"a", "b"}, expected: true},
+		{pattern: "a.b", path: Path{"a"}, expected: false},
+		{pattern: "a.*", path: Path{"a", 3}, expected: true},
+		{pattern: "a[3]", path: Path{"a", 3}, expected: true},
+		{pattern: "a[3]", path: Path{"a", "3"}, expected: false},
+		{pattern: "a.**", path: Path{"a"}, expected: true},
+		{pattern: "a.**", path: Path{"a", "b", 1}, expected: true},
+		{pattern: "**.image", path: Path{"spec", 0, "image"}, expected: true},
+		{pattern: `annotations["example.com/*"]`, path: Path{"annotations", "example.com/foo"}, expected: true},
+		{pattern: `annotations["example.com/*"]`, path: Path{"annotations", "other.com/foo"}, expected: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			pattern, err := ParsePath(tc.pattern)
+			if err != nil {
+				t.Fatalf("Failed to parse pattern: %v", err)
+			}
+
+			if result := matchPattern(pattern, tc.path); result != tc.expected {
+				t.Fatalf("Expected %v to match %q: %v, but got %v.", tc.path, tc.pattern, tc.expected, result)
+			}
+		})
+	}
+}
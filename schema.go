@@ -0,0 +1,792 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a parsed JSON Schema. It supports a subset of draft 2020-12,
+// namely the keywords type, enum, const, properties, required,
+// additionalProperties, patternProperties, minProperties, maxProperties,
+// items, prefixItems, minItems, maxItems, uniqueItems, minLength,
+// maxLength, pattern, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not and $ref
+// (to local definitions in $defs or definitions).
+type Schema struct {
+	// root is the schema document this schema is part of and
+	// used to resolve $refs.
+	root *schemaRoot
+
+	// always is set for the boolean schemas true and false.
+	always *bool
+
+	types                []string
+	enum                 []*yaml.Node
+	constant             *yaml.Node
+	defaultValue         *yaml.Node
+	ref                  string
+	properties           map[string]*Schema
+	propertyOrder        []string
+	required             []string
+	additionalProperties *Schema
+	patternProperties    map[string]*Schema
+	patterns             map[string]*regexp.Regexp
+	minProperties        *int
+	maxProperties        *int
+	items                *Schema
+	prefixItems          []*Schema
+	minItems             *int
+	maxItems             *int
+	uniqueItems          bool
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	multipleOf           *float64
+	allOf                []*Schema
+	anyOf                []*Schema
+	oneOf                []*Schema
+	not                  *Schema
+}
+
+// schemaRoot is shared by all subschemas. $refs are resolved lazily and
+// cached, so the cache is guarded by a lock to allow using the same
+// schema concurrently.
+type schemaRoot struct {
+	node *yaml.Node
+	lock sync.Mutex
+	refs map[string]*Schema
+}
+
+// Violation is a single validation error.
+type Violation struct {
+	// Path points to the offending node.
+	Path Path
+	// Line and Column point to the offending node in the source
+	// document, if the document was decoded from a source.
+	Line   int
+	Column int
+	// Keyword is the JSON Schema keyword that failed.
+	Keyword string
+	Message string
+}
+
+func (v Violation) Error() string {
+	location := v.Path.String()
+	if location == "" {
+		location = "(root)"
+	}
+
+	if v.Line > 0 {
+		return fmt.Sprintf("%s (line %d, column %d): %s", location, v.Line, v.Column, v.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", location, v.Message)
+}
+
+// ParseSchema parses a JSON Schema, given either as JSON or YAML.
+func ParseSchema(data []byte) (*Schema, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, errors.New("invalid schema: empty document")
+	}
+
+	root := &schemaRoot{
+		node: doc.Content[0],
+		refs: map[string]*Schema{},
+	}
+
+	schema, err := parseSchema(root, root.node)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	root.refs["#"] = schema
+
+	return schema, nil
+}
+
+func parseSchema(root *schemaRoot, n *yaml.Node) (*Schema, error) {
+	n = resolveAlias(n)
+	s := &Schema{root: root}
+
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!bool" {
+		always := n.Value == "true"
+		s.always = &always
+		return s, nil
+	}
+
+	if n.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("schema must be an object or boolean, got %s", KindName(n.Kind))
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keyword := n.Content[i].Value
+		value := resolveAlias(n.Content[i+1])
+
+		if err := s.parseKeyword(keyword, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", keyword, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Schema) parseKeyword(keyword string, value *yaml.Node) error {
+	var err error
+
+	switch keyword {
+	case "type":
+		s.types, err = parseStrings(value)
+
+	case "enum":
+		if value.Kind != yaml.SequenceNode {
+			return errors.New("must be an array")
+		}
+		s.enum = value.Content
+
+	case "const":
+		s.constant = value
+
+	case "default":
+		s.defaultValue = value
+
+	case "$ref":
+		s.ref = value.Value
+
+	case "properties":
+		if value.Kind != yaml.MappingNode {
+			return errors.New("must be an object")
+		}
+
+		s.properties = map[string]*Schema{}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			name := value.Content[i].Value
+
+			s.properties[name], err = parseSchema(s.root, value.Content[i+1])
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			s.propertyOrder = append(s.propertyOrder, name)
+		}
+
+	case "required":
+		s.required, err = parseStrings(value)
+
+	case "additionalProperties":
+		s.additionalProperties, err = parseSchema(s.root, value)
+
+	case "patternProperties":
+		if value.Kind != yaml.MappingNode {
+			return errors.New("must be an object")
+		}
+
+		s.patternProperties = map[string]*Schema{}
+		s.patterns = map[string]*regexp.Regexp{}
+
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			pattern := value.Content[i].Value
+
+			s.patterns[pattern], err = regexp.Compile(pattern)
+			if err != nil {
+				return err
+			}
+
+			s.patternProperties[pattern], err = parseSchema(s.root, value.Content[i+1])
+			if err != nil {
+				return fmt.Errorf("%s: %w", pattern, err)
+			}
+		}
+
+	case "minProperties":
+		s.minProperties, err = parseInt(value)
+
+	case "maxProperties":
+		s.maxProperties, err = parseInt(value)
+
+	case "items":
+		s.items, err = parseSchema(s.root, value)
+
+	case "prefixItems":
+		s.prefixItems, err = parseSchemas(s.root, value)
+
+	case "minItems":
+		s.minItems, err = parseInt(value)
+
+	case "maxItems":
+		s.maxItems, err = parseInt(value)
+
+	case "uniqueItems":
+		s.uniqueItems = value.Value == "true"
+
+	case "minLength":
+		s.minLength, err = parseInt(value)
+
+	case "maxLength":
+		s.maxLength, err = parseInt(value)
+
+	case "pattern":
+		s.pattern, err = regexp.Compile(value.Value)
+
+	case "minimum":
+		s.minimum, err = parseFloat(value)
+
+	case "maximum":
+		s.maximum, err = parseFloat(value)
+
+	case "exclusiveMinimum":
+		s.exclusiveMinimum, err = parseFloat(value)
+
+	case "exclusiveMaximum":
+		s.exclusiveMaximum, err = parseFloat(value)
+
+	case "multipleOf":
+		s.multipleOf, err = parseFloat(value)
+		if err == nil && *s.multipleOf <= 0 {
+			err = errors.New("must be > 0")
+		}
+
+	case "allOf":
+		s.allOf, err = parseSchemas(s.root, value)
+
+	case "anyOf":
+		s.anyOf, err = parseSchemas(s.root, value)
+
+	case "oneOf":
+		s.oneOf, err = parseSchemas(s.root, value)
+
+	case "not":
+		s.not, err = parseSchema(s.root, value)
+
+	default:
+		// unsupported keywords and annotations like title or description
+		// are ignored; definitions are parsed lazily when referenced
+	}
+
+	return err
+}
+
+func parseSchemas(root *schemaRoot, n *yaml.Node) ([]*Schema, error) {
+	if n.Kind != yaml.SequenceNode {
+		return nil, errors.New("must be an array")
+	}
+
+	schemas := make([]*Schema, 0, len(n.Content))
+	for i, item := range n.Content {
+		schema, err := parseSchema(root, item)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+func parseStrings(n *yaml.Node) ([]string, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return []string{n.Value}, nil
+
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, errors.New("must be a list of strings")
+			}
+
+			values = append(values, item.Value)
+		}
+
+		return values, nil
+
+	default:
+		return nil, errors.New("must be a string or list of strings")
+	}
+}
+
+func parseInt(n *yaml.Node) (*int, error) {
+	var i int
+	if err := n.Decode(&i); err != nil {
+		return nil, errors.New("must be an integer")
+	}
+
+	return &i, nil
+}
+
+func parseFloat(n *yaml.Node) (*float64, error) {
+	var f float64
+	if err := n.Decode(&f); err != nil {
+		return nil, errors.New("must be a number")
+	}
+
+	return &f, nil
+}
+
+// resolveRef returns the schema referenced by a local JSON pointer
+// like "#/$defs/name".
+func (r *schemaRoot) resolveRef(ref string) (*Schema, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if cached, ok := r.refs[ref]; ok {
+		return cached, nil
+	}
+
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local $refs are supported, cannot resolve %q", ref)
+	}
+
+	current := r.node
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		current = resolveAlias(current)
+
+		switch current.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(current.Content); i += 2 {
+				if current.Content[i].Value == token {
+					next = current.Content[i+1]
+					break
+				}
+			}
+
+			if next == nil {
+				return nil, fmt.Errorf("cannot resolve %q", ref)
+			}
+
+			current = next
+
+		case yaml.SequenceNode:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(current.Content) {
+				return nil, fmt.Errorf("cannot resolve %q", ref)
+			}
+
+			current = current.Content[idx]
+
+		default:
+			return nil, fmt.Errorf("cannot resolve %q", ref)
+		}
+	}
+
+	schema, err := parseSchema(r, current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema in %q: %w", ref, err)
+	}
+
+	r.refs[ref] = schema
+
+	return schema, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// validation
+
+// Validate checks the node against the schema and returns all violations.
+// An empty result means the node is valid.
+func (s *Schema) Validate(n Node) []Violation {
+	return s.validate(rawNode(n), Path{})
+}
+
+// ValidateDocument validates the root node of the given document.
+func (s *Schema) ValidateDocument(d Document) []Violation {
+	root, err := d.RootNode()
+	if err != nil {
+		return []Violation{{Path: Path{}, Message: err.Error()}}
+	}
+
+	return s.Validate(root)
+}
+
+func violation(n *yaml.Node, path Path, keyword string, format string, args ...interface{}) Violation {
+	return Violation{
+		Path:    append(Path{}, path...),
+		Line:    n.Line,
+		Column:  n.Column,
+		Keyword: keyword,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (s *Schema) validate(n *yaml.Node, path Path) []Violation {
+	n = resolveAlias(n)
+
+	if s.always != nil {
+		if *s.always {
+			return nil
+		}
+
+		return []Violation{violation(n, path, "false", "no value is allowed here")}
+	}
+
+	var violations []Violation
+
+	if s.ref != "" {
+		referenced, err := s.root.resolveRef(s.ref)
+		if err != nil {
+			return []Violation{violation(n, path, "$ref", "%v", err)}
+		}
+
+		violations = append(violations, referenced.validate(n, path)...)
+	}
+
+	jsonType := jsonTypeOf(n)
+
+	if len(s.types) > 0 && !typeMatches(jsonType, s.types) {
+		violations = append(violations, violation(n, path, "type", "expected %s, but got %s", strings.Join(s.types, " or "), jsonType))
+
+		// all further checks are meaningless
+		return violations
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, candidate := range s.enum {
+			if jsonEqual(n, candidate) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			violations = append(violations, violation(n, path, "enum", "value must be one of %s", formatValues(s.enum)))
+		}
+	}
+
+	if s.constant != nil && !jsonEqual(n, s.constant) {
+		violations = append(violations, violation(n, path, "const", "value must be %s", formatValues([]*yaml.Node{s.constant})))
+	}
+
+	switch jsonType {
+	case "object":
+		violations = append(violations, s.validateObject(n, path)...)
+	case "array":
+		violations = append(violations, s.validateArray(n, path)...)
+	case "string":
+		violations = append(violations, s.validateString(n, path)...)
+	case "integer", "number":
+		violations = append(violations, s.validateNumber(n, path)...)
+	}
+
+	for _, sub := range s.allOf {
+		violations = append(violations, sub.validate(n, path)...)
+	}
+
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if len(sub.validate(n, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			violations = append(violations, violation(n, path, "anyOf", "value must match at least one of %d schemas", len(s.anyOf)))
+		}
+	}
+
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if len(sub.validate(n, path)) == 0 {
+				matches++
+			}
+		}
+
+		if matches != 1 {
+			violations = append(violations, violation(n, path, "oneOf", "value must match exactly one of %d schemas, but matches %d", len(s.oneOf), matches))
+		}
+	}
+
+	if s.not != nil && len(s.not.validate(n, path)) == 0 {
+		violations = append(violations, violation(n, path, "not", "value must not match the schema"))
+	}
+
+	return violations
+}
+
+func (s *Schema) validateObject(n *yaml.Node, path Path) []Violation {
+	var violations []Violation
+
+	present := map[string]bool{}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		value := n.Content[i+1]
+		name := key.Value
+		childPath := append(path, name)
+
+		present[name] = true
+		covered := false
+
+		if sub, ok := s.properties[name]; ok {
+			covered = true
+			violations = append(violations, sub.validate(value, childPath)...)
+		}
+
+		for pattern, sub := range s.patternProperties {
+			if s.patterns[pattern].MatchString(name) {
+				covered = true
+				violations = append(violations, sub.validate(value, childPath)...)
+			}
+		}
+
+		if !covered && s.additionalProperties != nil {
+			if always := s.additionalProperties.always; always != nil && !*always {
+				violations = append(violations, violation(key, childPath, "additionalProperties", "property %q is not allowed", name))
+			} else {
+				violations = append(violations, s.additionalProperties.validate(value, childPath)...)
+			}
+		}
+	}
+
+	for _, name := range s.required {
+		if !present[name] {
+			violations = append(violations, violation(n, path, "required", "missing required property %q", name))
+		}
+	}
+
+	if s.minProperties != nil && len(present) < *s.minProperties {
+		violations = append(violations, violation(n, path, "minProperties", "must have at least %d properties", *s.minProperties))
+	}
+
+	if s.maxProperties != nil && len(present) > *s.maxProperties {
+		violations = append(violations, violation(n, path, "maxProperties", "must have at most %d properties", *s.maxProperties))
+	}
+
+	return violations
+}
+
+func (s *Schema) validateArray(n *yaml.Node, path Path) []Violation {
+	var violations []Violation
+
+	for i, item := range n.Content {
+		childPath := append(path, i)
+
+		switch {
+		case i < len(s.prefixItems):
+			violations = append(violations, s.prefixItems[i].validate(item, childPath)...)
+		case s.items != nil:
+			violations = append(violations, s.items.validate(item, childPath)...)
+		}
+	}
+
+	if s.minItems != nil && len(n.Content) < *s.minItems {
+		violations = append(violations, violation(n, path, "minItems", "must have at least %d items", *s.minItems))
+	}
+
+	if s.maxItems != nil && len(n.Content) > *s.maxItems {
+		violations = append(violations, violation(n, path, "maxItems", "must have at most %d items", *s.maxItems))
+	}
+
+	if s.uniqueItems {
+		for i := 0; i < len(n.Content); i++ {
+			for j := i + 1; j < len(n.Content); j++ {
+				if jsonEqual(n.Content[i], n.Content[j]) {
+					violations = append(violations, violation(n.Content[j], append(path, j), "uniqueItems", "item is a duplicate of item %d", i))
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+func (s *Schema) validateString(n *yaml.Node, path Path) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(n.Value)
+
+	if s.minLength != nil && length < *s.minLength {
+		violations = append(violations, violation(n, path, "minLength", "must be at least %d characters long", *s.minLength))
+	}
+
+	if s.maxLength != nil && length > *s.maxLength {
+		violations = append(violations, violation(n, path, "maxLength", "must be at most %d characters long", *s.maxLength))
+	}
+
+	if s.pattern != nil && !s.pattern.MatchString(n.Value) {
+		violations = append(violations, violation(n, path, "pattern", "must match pattern %q", s.pattern.String()))
+	}
+
+	return violations
+}
+
+func (s *Schema) validateNumber(n *yaml.Node, path Path) []Violation {
+	var value float64
+	if err := n.Decode(&value); err != nil {
+		return []Violation{violation(n, path, "type", "invalid number %q", n.Value)}
+	}
+
+	var violations []Violation
+
+	if s.minimum != nil && value < *s.minimum {
+		violations = append(violations, violation(n, path, "minimum", "must be >= %v", *s.minimum))
+	}
+
+	if s.maximum != nil && value > *s.maximum {
+		violations = append(violations, violation(n, path, "maximum", "must be <= %v", *s.maximum))
+	}
+
+	if s.exclusiveMinimum != nil && value <= *s.exclusiveMinimum {
+		violations = append(violations, violation(n, path, "exclusiveMinimum", "must be > %v", *s.exclusiveMinimum))
+	}
+
+	if s.exclusiveMaximum != nil && value >= *s.exclusiveMaximum {
+		violations = append(violations, violation(n, path, "exclusiveMaximum", "must be < %v", *s.exclusiveMaximum))
+	}
+
+	if s.multipleOf != nil {
+		if quotient := value / *s.multipleOf; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			violations = append(violations, violation(n, path, "multipleOf", "must be a multiple of %v", *s.multipleOf))
+		}
+	}
+
+	return violations
+}
+
+/////////////////////////////////////////////////////////////////////
+// helpers
+
+// jsonTypeOf returns the JSON Schema type name for the given node.
+func jsonTypeOf(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!null":
+			return "null"
+		case "!!bool":
+			return "boolean"
+		case "!!int":
+			return "integer"
+		case "!!float":
+			var f float64
+			if err := n.Decode(&f); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return "integer"
+			}
+
+			return "number"
+		default:
+			return "string"
+		}
+	default:
+		return KindName(n.Kind)
+	}
+}
+
+func typeMatches(actual string, allowed []string) bool {
+	for _, t := range allowed {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonEqual compares two nodes by their JSON value, i.e. ignoring
+// comments, styles and the order of keys.
+func jsonEqual(a, b *yaml.Node) bool {
+	a = resolveAlias(a)
+	b = resolveAlias(b)
+
+	typeA := jsonTypeOf(a)
+	typeB := jsonTypeOf(b)
+
+	switch {
+	case (typeA == "integer" || typeA == "number") && (typeB == "integer" || typeB == "number"):
+		var fa, fb float64
+		return a.Decode(&fa) == nil && b.Decode(&fb) == nil && fa == fb
+
+	case typeA != typeB:
+		return false
+
+	case typeA == "array":
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+
+		for i := range a.Content {
+			if !jsonEqual(a.Content[i], b.Content[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	case typeA == "object":
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			found := false
+
+			for j := 0; j+1 < len(b.Content); j += 2 {
+				if a.Content[i].Value == b.Content[j].Value {
+					found = jsonEqual(a.Content[i+1], b.Content[j+1])
+					break
+				}
+			}
+
+			if !found {
+				return false
+			}
+		}
+
+		return true
+
+	case typeA == "boolean":
+		var ba, bb bool
+		return a.Decode(&ba) == nil && b.Decode(&bb) == nil && ba == bb
+
+	case typeA == "null":
+		// "~", "null" and an empty value are all the same
+		return true
+
+	default:
+		return a.Value == b.Value
+	}
+}
+
+func formatValues(nodes []*yaml.Node) string {
+	values := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		encoded, err := yaml.Marshal(n)
+		if err != nil {
+			values = append(values, n.Value)
+			continue
+		}
+
+		values = append(values, strings.TrimSpace(string(encoded)))
+	}
+
+	return "[" + strings.Join(values, ", ") + "]"
+}
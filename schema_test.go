@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testSchema = `
+{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["name", "replicas"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 10},
+    "replicas": {"type": "integer", "minimum": 1, "maximum": 5},
+    "mode": {"enum": ["fast", "slow"]},
+    "ports": {
+      "type": "array",
+      "minItems": 1,
+      "uniqueItems": true,
+      "items": {"$ref": "#/$defs/port"}
+    },
+    "labels": {
+      "type": "object",
+      "additionalProperties": {"type": "string"}
+    },
+    "target": {
+      "oneOf": [
+        {"type": "object", "required": ["host"]},
+        {"type": "object", "required": ["ip"]}
+      ]
+    }
+  },
+  "$defs": {
+    "port": {
+      "anyOf": [
+        {"type": "integer", "exclusiveMinimum": 0, "maximum": 65535},
+        {"type": "string", "pattern": "^[0-9]+/(tcp|udp)$"}
+      ]
+    }
+  }
+}
+`
+
+func loadSchema(t *testing.T) *Schema {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	return schema
+}
+
+func TestSchemaValidDocument(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(`
+name: web
+replicas: 3
+mode: fast
+ports: [80, "53/udp"]
+labels:
+  app: web
+target:
+  host: example.com
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if violations := loadSchema(t).ValidateDocument(doc); len(violations) > 0 {
+		t.Fatalf("Expected document to be valid, but got %v.", violations)
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(`
+name: Web
+replicas: 2.5
+mode: medium
+ports:
+  - 80
+  - 80
+  - 70000
+labels:
+  app: 12
+target:
+  host: example.com
+  ip: 1.2.3.4
+unknown: true
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	violations := loadSchema(t).ValidateDocument(doc)
+
+	expected := []string{
+		`name (line 1, column 7): must match pattern "^[a-z]+$"`,
+		`replicas (line 2, column 11): expected integer, but got number`,
+		`mode (line 3, column 7): value must be one of ["fast", "slow"]`,
+		`ports.[2] (line 7, column 5): value must match at least one of 2 schemas`,
+		`ports.[1] (line 6, column 5): item is a duplicate of item 0`,
+		`labels.app (line 9, column 8): expected string, but got integer`,
+		`target (line 11, column 3): value must match exactly one of 2 schemas, but matches 2`,
+		`unknown (line 13, column 1): property "unknown" is not allowed`,
+	}
+
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, but got %d: %v", len(expected), len(violations), violations)
+	}
+
+	for i, v := range violations {
+		if v.Error() != expected[i] {
+			t.Errorf("Expected violation %d to be %q, but got %q.", i, expected[i], v.Error())
+		}
+	}
+}
+
+func TestSchemaRequired(t *testing.T) {
+	_, doc, err := yamlLoad(`name: web`)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	violations := loadSchema(t).ValidateDocument(doc)
+	if len(violations) != 1 {
+		t.Fatalf("Expected 1 violation, but got %v.", violations)
+	}
+
+	if v := violations[0]; v.Keyword != "required" || len(v.Path) != 0 {
+		t.Fatalf("Expected a required violation on the root, but got %+v.", v)
+	}
+}
+
+func TestSchemaValidateSubtree(t *testing.T) {
+	schema, err := ParseSchema([]byte(`
+type: array
+items:
+  type: string
+  minLength: 2
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	_, doc, err := yamlLoad(strings.TrimSpace(`
+spec:
+  names: [ab, c]
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	violations := schema.Validate(doc.MustGet("spec", "names"))
+	if len(violations) != 1 {
+		t.Fatalf("Expected 1 violation, but got %v.", violations)
+	}
+
+	if v := violations[0]; v.Path.String() != "[1]" || v.Line != 2 || v.Column != 15 {
+		t.Fatalf("Unexpected violation: %+v", v)
+	}
+}
+
+func TestParseInvalidSchema(t *testing.T) {
+	for _, input := range []string{`[1, 2]`, `{"type": {}}`, `{"pattern": "("}`, `{"minLength": "a"}`, `{"items": 1}`} {
+		if _, err := ParseSchema([]byte(input)); err == nil {
+			t.Errorf("Should not have been able to parse %s.", input)
+		}
+	}
+}
+
+func TestSchemaNullValues(t *testing.T) {
+	schema, err := ParseSchema([]byte(`
+properties:
+  x:
+    enum: [null, "a"]
+  y:
+    const: ~
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	for _, input := range []string{"x: ~\ny: null", "x:\ny:", "x: null\ny: ~"} {
+		_, doc, err := yamlLoad(input)
+		if err != nil {
+			t.Fatalf("Failed to load YAML: %v", err)
+		}
+
+		if violations := schema.ValidateDocument(doc); len(violations) > 0 {
+			t.Errorf("Expected %q to be valid, but got %v.", input, violations)
+		}
+	}
+}
+
+func TestSchemaValidateConcurrently(t *testing.T) {
+	schema := loadSchema(t)
+
+	_, doc, err := yamlLoad(strings.TrimSpace(`
+name: web
+replicas: 3
+ports: [80, "53/udp"]
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	// resolving $refs must not race, see "go test -race"
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if violations := schema.ValidateDocument(doc); len(violations) > 0 {
+				t.Errorf("Expected document to be valid, but got %v.", violations)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetCommentBefore sets the comment in the lines before the mapping entry
+// or sequence item at the given path, replacing any previous comment
+// there. Lines are plain lines like for SetCommentLines(). For mapping
+// entries, the comment is placed on the key, so it is rendered above the
+// key even if the value is a collection.
+func (n *node) SetCommentBefore(path Path, lines ...string) error {
+	return n.commentSlot(path, func(container *yaml.Node, index int) {
+		entry := container.Content[index]
+		n.tree.setComment(entry, CommentHead, replaceComment(entry.HeadComment, lines))
+	})
+}
+
+// SetCommentAfter sets the comment in the lines after the mapping entry
+// or sequence item at the given path, replacing any previous comment
+// there.
+//
+// yaml.v3 cannot render a comment after a sequence item that is itself a
+// mapping or sequence; when parsed, such a comment becomes the head
+// comment of the following item anyway. So for these items the comment
+// is put in front of the next item's head comment, separated by a blank
+// line, or, for the last item, after the item's last entry. In both cases
+// an earlier comment set this way is not replaced.
+func (n *node) SetCommentAfter(path Path, lines ...string) error {
+	return n.commentSlot(path, func(container *yaml.Node, index int) {
+		n.tree.setCommentAfter(container, index, formatComment(lines))
+	})
+}
+
+// commentSlot is like entry(), but fails if the path does not exist and
+// calls fn with the collection and the position of the entry in it. As
+// comments in flow collections cannot be rendered, the collection is
+// switched to block style.
+func (n *node) commentSlot(path Path, fn func(container *yaml.Node, index int)) error {
+	parent, index, err := n.entry(path)
+	if err != nil {
+		return err
+	}
+
+	if index < 0 {
+		return fmt.Errorf("path %q not found", path.String())
+	}
+
+	// the flow style is inherited by all children, so the ancestors
+	// need to be switched as well
+	ancestors := []*yaml.Node{n.node}
+	for i := 1; i < len(path)-1; i++ {
+		ancestor, _, _ := n.get(path[:i]...)
+		ancestors = append(ancestors, ancestor.(*node).node)
+	}
+
+	ancestors = append(ancestors, parent.node)
+
+	for i, ancestor := range ancestors {
+		if ancestor.Style&yaml.FlowStyle == 0 {
+			continue
+		}
+
+		// the outermost flow collection is replaced as a whole
+		return n.tree.change(ancestor, func() error {
+			for _, a := range ancestors[i:] {
+				a.Style &^= yaml.FlowStyle
+			}
+
+			fn(parent.node, index)
+
+			return nil
+		})
+	}
+
+	fn(parent.node, index)
+
+	return nil
+}
+
+func (t *tree) setCommentAfter(container *yaml.Node, index int, comment string) {
+	if container.Kind == yaml.MappingNode {
+		t.setComment(container.Content[index], CommentFoot, comment)
+		return
+	}
+
+	item := container.Content[index]
+	if (item.Kind != yaml.MappingNode && item.Kind != yaml.SequenceNode) || len(item.Content) == 0 {
+		t.setComment(item, CommentFoot, comment)
+		return
+	}
+
+	if comment == "" {
+		return
+	}
+
+	if index+1 < len(container.Content) {
+		next := container.Content[index+1]
+		t.setComment(next, CommentHead, prependComment(next.HeadComment, comment))
+		return
+	}
+
+	last := lastFootComment(item)
+	t.setComment(last, CommentFoot, joinParagraphs(last.FootComment, comment))
+}
+
+// lastFootComment returns the node with the last foot comment in the
+// collection that yaml.v3 can render, descending into nested sequences.
+func lastFootComment(n *yaml.Node) *yaml.Node {
+	for {
+		if n.Kind == yaml.MappingNode {
+			return n.Content[len(n.Content)-2]
+		}
+
+		last := n.Content[len(n.Content)-1]
+		if (last.Kind != yaml.MappingNode && last.Kind != yaml.SequenceNode) || len(last.Content) == 0 {
+			return last
+		}
+
+		n = last
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// Document
+
+// SetCommentBefore works like Node.SetCommentBefore(). An empty path
+// refers to the document itself, so the comment is put at the very
+// beginning of the document.
+func (d *document) SetCommentBefore(path Path, lines ...string) error {
+	if len(path) == 0 {
+		d.setComment(CommentHead, replaceComment(d.node.HeadComment, lines))
+		return nil
+	}
+
+	root, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	return root.SetCommentBefore(path, lines...)
+}
+
+// SetCommentAfter works like Node.SetCommentAfter(). An empty path
+// refers to the document itself, so the comment is put at the very end
+// of the document.
+func (d *document) SetCommentAfter(path Path, lines ...string) error {
+	if len(path) == 0 {
+		d.setComment(CommentFoot, replaceComment(d.node.FootComment, lines))
+		return nil
+	}
+
+	root, err := d.RootNode()
+	if err != nil {
+		return err
+	}
+
+	return root.SetCommentAfter(path, lines...)
+}
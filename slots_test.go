@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"strings"
+	"testing"
+)
+
+const slotsInput = `
+name: web
+server:
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  - name: sidecar
+ports: [80, 443]
+`
+
+func TestSetCommentSlots(t *testing.T) {
+	testcases := []struct {
+		name     string
+		path     Path
+		after    bool
+		expected string
+	}{
+		{
+			name: "before a nested key",
+			path: Path{"server", "port"},
+			expected: `
+name: web
+server:
+  # note
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  - name: sidecar
+ports: [80, 443]
+`,
+		},
+		{
+			name:  "after a key with a collection value",
+			path:  Path{"server"},
+			after: true,
+			expected: `
+name: web
+server:
+  port: 80
+# note
+
+list:
+  - a
+  - b
+containers:
+  - name: app
+  - name: sidecar
+ports: [80, 443]
+`,
+		},
+		{
+			name:  "after a scalar item",
+			path:  Path{"list", 0},
+			after: true,
+			expected: `
+name: web
+server:
+  port: 80
+list:
+  - a
+  # note
+
+  - b
+containers:
+  - name: app
+  - name: sidecar
+ports: [80, 443]
+`,
+		},
+		{
+			name: "before a mapping item",
+			path: Path{"containers", Where("name", "sidecar")},
+			expected: `
+name: web
+server:
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  # note
+  - name: sidecar
+ports: [80, 443]
+`,
+		},
+		{
+			name:  "after a mapping item",
+			path:  Path{"containers", 0},
+			after: true,
+			expected: `
+name: web
+server:
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  # note
+  - name: sidecar
+ports: [80, 443]
+`,
+		},
+		{
+			name:  "after the last mapping item",
+			path:  Path{"containers", -1},
+			after: true,
+			expected: `
+name: web
+server:
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  - name: sidecar
+    # note
+ports: [80, 443]
+`,
+		},
+		{
+			name: "item in a flow sequence",
+			path: Path{"ports", 1},
+			expected: `
+name: web
+server:
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  - name: sidecar
+ports:
+  - 80
+  # note
+  - 443
+`,
+		},
+		{
+			name:  "end of document",
+			path:  Path{},
+			after: true,
+			expected: `
+name: web
+server:
+  port: 80
+list:
+  - a
+  - b
+containers:
+  - name: app
+  - name: sidecar
+ports: [80, 443]
+
+# note
+`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, doc, err := yamlLoad(strings.TrimSpace(slotsInput))
+			if err != nil {
+				t.Fatalf("Failed to load YAML: %v", err)
+			}
+
+			doc.EnableHistory()
+
+			set := doc.SetCommentBefore
+			if tc.after {
+				set = doc.SetCommentAfter
+			}
+
+			if err := set(tc.path, "note"); err != nil {
+				t.Fatalf("Failed to set comment: %v", err)
+			}
+
+			expectYAML(t, node, tc.expected)
+
+			// the comment must end up in the same place after parsing
+			reloaded, _, err := yamlLoad(strings.TrimSpace(tc.expected))
+			if err != nil {
+				t.Fatalf("Failed to load YAML: %v", err)
+			}
+
+			expectYAML(t, reloaded, tc.expected)
+
+			if err := doc.Undo(); err != nil {
+				t.Fatalf("Failed to undo: %v", err)
+			}
+
+			expectYAML(t, node, slotsInput)
+		})
+	}
+}
+
+func TestSetCommentSlotsMissingPath(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(slotsInput))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	if err := doc.SetCommentBefore(Path{"list", 5}, "note"); err == nil {
+		t.Fatal("Expected error for missing path.")
+	}
+}
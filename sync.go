@@ -0,0 +1,615 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyncDocument wraps a Document to make it safe for concurrent use.
+// Reads can happen in parallel, writes are exclusive.
+//
+// Nodes returned by SyncDocument (e.g. from Get() or SetAt()) are
+// copies, so reading them cannot race with concurrent writes, but
+// changing them does not change the document either. Use the
+// SyncDocument's methods or Write() to make changes.
+//
+// Observers registered via Observe() are called while the write lock
+// is held and must not call back into the SyncDocument.
+type SyncDocument struct {
+	lock sync.RWMutex
+	doc  Document
+
+	// snapshot caches the last snapshot until the next write.
+	snapshot atomic.Pointer[snapshotDocument]
+}
+
+var _ Document = &SyncDocument{}
+
+// NewSyncDocument wraps the document. The document must not be used
+// directly anymore afterwards.
+func NewSyncDocument(doc Document) *SyncDocument {
+	return &SyncDocument{
+		doc: doc,
+	}
+}
+
+// Snapshot returns an immutable copy of the document. Snapshots are
+// cached until the next write, so many readers can share the same
+// snapshot without ever having to wait for a writer. Changing a
+// snapshot through the Document API fails with ErrReadOnlySnapshot
+// (or does nothing, for the comment setters); nodes returned from a
+// snapshot are shared between all readers and must not be changed.
+func (s *SyncDocument) Snapshot() Document {
+	if snapshot := s.snapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	// another reader might have been faster
+	if snapshot := s.snapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+
+	clone := s.doc.Clone()
+
+	// readers need to know which paths are protected
+	if original, ok := s.doc.(*document); ok {
+		clone.(*document).protection = original.protection.clone()
+	}
+
+	snapshot := &snapshotDocument{
+		Document: clone,
+	}
+
+	s.snapshot.Store(snapshot)
+
+	return snapshot
+}
+
+// Read calls fn with the wrapped document while holding the read lock.
+// fn must not change the document or keep references to its nodes.
+func (s *SyncDocument) Read(fn func(doc Document) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return fn(s.doc)
+}
+
+// Write calls fn with the wrapped document while holding the write
+// lock, so that multiple changes can be made atomically.
+func (s *SyncDocument) Write(fn func(doc Document) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer s.snapshot.Store(nil)
+
+	return fn(s.doc)
+}
+
+func (s *SyncDocument) read(fn func()) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	fn()
+}
+
+func (s *SyncDocument) write(fn func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer s.snapshot.Store(nil)
+
+	fn()
+}
+
+func cloneResult(n Node) Node {
+	if n == nil {
+		return nil
+	}
+
+	return n.Clone()
+}
+
+/////////////////////////////////////////////////////////////////////
+// encoding
+
+func (s *SyncDocument) MarshalYAML() (interface{}, error) {
+	return s.doc.MarshalYAML()
+}
+
+func (s *SyncDocument) Bytes(indent int) (result []byte, err error) {
+	s.read(func() { result, err = s.doc.Bytes(indent) })
+	return result, err
+}
+
+func (s *SyncDocument) Encode(encoder *yaml.Encoder) (err error) {
+	s.read(func() { err = s.doc.Encode(encoder) })
+	return err
+}
+
+func (s *SyncDocument) SaveFile(path string, opts ...SaveOption) (err error) {
+	s.read(func() { err = s.doc.SaveFile(path, opts...) })
+	return err
+}
+
+func (s *SyncDocument) Format() (format Format) {
+	s.read(func() { format = s.doc.Format() })
+	return format
+}
+
+func (s *SyncDocument) SetFormat(format Format) Document {
+	s.write(func() { s.doc.SetFormat(format) })
+	return s
+}
+
+func (s *SyncDocument) Clone() (clone Document) {
+	s.read(func() { clone = s.doc.Clone() })
+	return clone
+}
+
+/////////////////////////////////////////////////////////////////////
+// traversal - reading
+
+func (s *SyncDocument) RootNode() (result Node, err error) {
+	s.read(func() {
+		result, err = s.doc.RootNode()
+		result = cloneResult(result)
+	})
+
+	return result, err
+}
+
+func (s *SyncDocument) Get(steps ...Step) (result Node, found bool) {
+	s.read(func() {
+		result, found = s.doc.Get(steps...)
+		result = cloneResult(result)
+	})
+
+	return result, found
+}
+
+func (s *SyncDocument) GetKey(steps ...Step) (result KeyNode, found bool) {
+	s.read(func() {
+		result, found = s.doc.GetKey(steps...)
+		if asserted, ok := result.(*keyNode); ok {
+			result = &keyNode{node: cloneNode(asserted.node)}
+		}
+	})
+
+	return result, found
+}
+
+func (s *SyncDocument) MustGet(steps ...Step) (result Node) {
+	s.read(func() {
+		result = cloneResult(s.doc.MustGet(steps...))
+	})
+
+	return result
+}
+
+func (s *SyncDocument) IsReadOnly(path Path) (readOnly bool) {
+	s.read(func() { readOnly = s.doc.IsReadOnly(path) })
+	return readOnly
+}
+
+func (s *SyncDocument) Markers(name string) (result []Marker) {
+	s.read(func() {
+		result = s.doc.Markers(name)
+		for i := range result {
+			result[i].Node = cloneResult(result[i].Node)
+		}
+	})
+
+	return result
+}
+
+func (s *SyncDocument) DuplicateKeys() (result []DuplicateKey) {
+	s.read(func() { result = s.doc.DuplicateKeys() })
+	return result
+}
+
+/////////////////////////////////////////////////////////////////////
+// traversal - writing
+
+func (s *SyncDocument) Set(value interface{}) (err error) {
+	s.write(func() { err = s.doc.Set(value) })
+	return err
+}
+
+func (s *SyncDocument) SetKey(key Step, value interface{}) (result Node, err error) {
+	s.write(func() {
+		result, err = s.doc.SetKey(key, value)
+		result = cloneResult(result)
+	})
+
+	return result, err
+}
+
+func (s *SyncDocument) SetAt(path Path, value interface{}) (result Node, err error) {
+	s.write(func() {
+		result, err = s.doc.SetAt(path, value)
+		result = cloneResult(result)
+	})
+
+	return result, err
+}
+
+func (s *SyncDocument) Replace(value interface{}) (err error) {
+	s.write(func() { err = s.doc.Replace(value) })
+	return err
+}
+
+func (s *SyncDocument) ReplaceKey(key Step, value interface{}) (result Node, err error) {
+	s.write(func() {
+		result, err = s.doc.ReplaceKey(key, value)
+		result = cloneResult(result)
+	})
+
+	return result, err
+}
+
+func (s *SyncDocument) ReplaceAt(path Path, value interface{}) (result Node, err error) {
+	s.write(func() {
+		result, err = s.doc.ReplaceAt(path, value)
+		result = cloneResult(result)
+	})
+
+	return result, err
+}
+
+func (s *SyncDocument) UpdateFrom(value interface{}) (err error) {
+	s.write(func() { err = s.doc.UpdateFrom(value) })
+	return err
+}
+
+func (s *SyncDocument) Edit(path Path, fn func(n *yaml.Node) error) (err error) {
+	s.write(func() { err = s.doc.Edit(path, fn) })
+	return err
+}
+
+func (s *SyncDocument) DeleteKey(steps ...Step) (err error) {
+	s.write(func() { err = s.doc.DeleteKey(steps...) })
+	return err
+}
+
+func (s *SyncDocument) SetMarkers(name string, value string, newValue interface{}) (count int, err error) {
+	s.write(func() { count, err = s.doc.SetMarkers(name, value, newValue) })
+	return count, err
+}
+
+func (s *SyncDocument) DeleteAt(path Path, opts DeleteOptions) (err error) {
+	s.write(func() { err = s.doc.DeleteAt(path, opts) })
+	return err
+}
+
+// Transaction holds the write lock while fn is running.
+func (s *SyncDocument) Transaction(fn func(tx Tx) error) (err error) {
+	s.write(func() { err = s.doc.Transaction(fn) })
+	return err
+}
+
+/////////////////////////////////////////////////////////////////////
+// history, observers and protection
+
+func (s *SyncDocument) EnableHistory() {
+	s.write(s.doc.EnableHistory)
+}
+
+func (s *SyncDocument) DisableHistory() {
+	s.write(s.doc.DisableHistory)
+}
+
+func (s *SyncDocument) CanUndo() (result bool) {
+	s.read(func() { result = s.doc.CanUndo() })
+	return result
+}
+
+func (s *SyncDocument) CanRedo() (result bool) {
+	s.read(func() { result = s.doc.CanRedo() })
+	return result
+}
+
+func (s *SyncDocument) Undo() (err error) {
+	s.write(func() { err = s.doc.Undo() })
+	return err
+}
+
+func (s *SyncDocument) Redo() (err error) {
+	s.write(func() { err = s.doc.Redo() })
+	return err
+}
+
+// Group holds the write lock while fn is running, so fn cannot use
+// the SyncDocument. Use Write() and call Group() on the wrapped
+// document instead.
+func (s *SyncDocument) Group(fn func() error) (err error) {
+	s.write(func() { err = s.doc.Group(fn) })
+	return err
+}
+
+func (s *SyncDocument) ExportHistory() (result []byte, err error) {
+	s.read(func() { result, err = s.doc.ExportHistory() })
+	return result, err
+}
+
+func (s *SyncDocument) ImportHistory(data []byte) (err error) {
+	s.write(func() { err = s.doc.ImportHistory(data) })
+	return err
+}
+
+func (s *SyncDocument) Observe(fn ObserverFunc) func() {
+	var remove func()
+	s.write(func() { remove = s.doc.Observe(fn) })
+
+	return func() {
+		s.write(remove)
+	}
+}
+
+func (s *SyncDocument) Protect(patterns ...string) (err error) {
+	s.write(func() { err = s.doc.Protect(patterns...) })
+	return err
+}
+
+func (s *SyncDocument) Unprotect() {
+	s.write(s.doc.Unprotect)
+}
+
+func (s *SyncDocument) EnableKeyIndex() {
+	s.write(s.doc.EnableKeyIndex)
+}
+
+func (s *SyncDocument) DisableKeyIndex() {
+	s.write(s.doc.DisableKeyIndex)
+}
+
+func (s *SyncDocument) SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) Document {
+	s.write(func() { s.doc.SetDuplicateKeyPolicy(policy) })
+	return s
+}
+
+/////////////////////////////////////////////////////////////////////
+// conversions
+
+func (s *SyncDocument) ToSlice() (result []interface{}) {
+	s.read(func() { result = s.doc.ToSlice() })
+	return result
+}
+
+func (s *SyncDocument) ToMap() (result map[string]interface{}) {
+	s.read(func() { result = s.doc.ToMap() })
+	return result
+}
+
+func (s *SyncDocument) To(val interface{}) (err error) {
+	s.read(func() { err = s.doc.To(val) })
+	return err
+}
+
+/////////////////////////////////////////////////////////////////////
+// comment API passthrough
+
+func (s *SyncDocument) HeadComment() (comment string) {
+	s.read(func() { comment = s.doc.HeadComment() })
+	return comment
+}
+
+func (s *SyncDocument) LineComment() (comment string) {
+	s.read(func() { comment = s.doc.LineComment() })
+	return comment
+}
+
+func (s *SyncDocument) FootComment() (comment string) {
+	s.read(func() { comment = s.doc.FootComment() })
+	return comment
+}
+
+func (s *SyncDocument) SetHeadComment(comment string) Document {
+	s.write(func() { s.doc.SetHeadComment(comment) })
+	return s
+}
+
+func (s *SyncDocument) SetLineComment(comment string) Document {
+	s.write(func() { s.doc.SetLineComment(comment) })
+	return s
+}
+
+func (s *SyncDocument) SetFootComment(comment string) Document {
+	s.write(func() { s.doc.SetFootComment(comment) })
+	return s
+}
+
+func (s *SyncDocument) CommentLines(pos CommentPosition) (lines []string) {
+	s.read(func() { lines = s.doc.CommentLines(pos) })
+	return lines
+}
+
+func (s *SyncDocument) SetCommentLines(pos CommentPosition, lines ...string) Document {
+	s.write(func() { s.doc.SetCommentLines(pos, lines...) })
+	return s
+}
+
+func (s *SyncDocument) AppendCommentLine(pos CommentPosition, line string) Document {
+	s.write(func() { s.doc.AppendCommentLine(pos, line) })
+	return s
+}
+
+func (s *SyncDocument) StripComments() Document {
+	s.write(func() { s.doc.StripComments() })
+	return s
+}
+
+func (s *SyncDocument) FindComments(pattern *regexp.Regexp) (result []CommentMatch) {
+	s.read(func() {
+		result = s.doc.FindComments(pattern)
+		for i := range result {
+			result[i].Node = cloneResult(result[i].Node)
+		}
+	})
+
+	return result
+}
+
+func (s *SyncDocument) SetCommentBefore(path Path, lines ...string) (err error) {
+	s.write(func() { err = s.doc.SetCommentBefore(path, lines...) })
+	return err
+}
+
+func (s *SyncDocument) SetCommentAfter(path Path, lines ...string) (err error) {
+	s.write(func() { err = s.doc.SetCommentAfter(path, lines...) })
+	return err
+}
+
+func (s *SyncDocument) BlankLinesBefore(path Path) (count int) {
+	s.read(func() { count = s.doc.BlankLinesBefore(path) })
+	return count
+}
+
+func (s *SyncDocument) SetBlankLinesBefore(path Path, count int) (err error) {
+	s.write(func() { err = s.doc.SetBlankLinesBefore(path, count) })
+	return err
+}
+
+/////////////////////////////////////////////////////////////////////
+// snapshots
+
+var ErrReadOnlySnapshot = errors.New("snapshots cannot be changed")
+
+// snapshotDocument is a Document that rejects all changes.
+type snapshotDocument struct {
+	Document
+}
+
+func (s *snapshotDocument) SetFormat(Format) Document {
+	return s
+}
+
+func (s *snapshotDocument) Set(interface{}) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) SetKey(Step, interface{}) (Node, error) {
+	return nil, ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) SetAt(Path, interface{}) (Node, error) {
+	return nil, ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Replace(interface{}) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) ReplaceKey(Step, interface{}) (Node, error) {
+	return nil, ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) ReplaceAt(Path, interface{}) (Node, error) {
+	return nil, ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) UpdateFrom(interface{}) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Edit(Path, func(*yaml.Node) error) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) DeleteKey(...Step) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) DeleteAt(Path, DeleteOptions) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) SetMarkers(string, string, interface{}) (int, error) {
+	return 0, ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Transaction(func(tx Tx) error) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) EnableHistory() {}
+
+func (s *snapshotDocument) DisableHistory() {}
+
+func (s *snapshotDocument) Undo() error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Redo() error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Group(func() error) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) ImportHistory([]byte) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Observe(ObserverFunc) func() {
+	// snapshots never change
+	return func() {}
+}
+
+func (s *snapshotDocument) Protect(...string) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) Unprotect() {}
+
+func (s *snapshotDocument) EnableKeyIndex() {}
+
+func (s *snapshotDocument) DisableKeyIndex() {}
+
+func (s *snapshotDocument) SetDuplicateKeyPolicy(DuplicateKeyPolicy) Document {
+	return s
+}
+
+func (s *snapshotDocument) SetHeadComment(string) Document {
+	return s
+}
+
+func (s *snapshotDocument) SetLineComment(string) Document {
+	return s
+}
+
+func (s *snapshotDocument) SetFootComment(string) Document {
+	return s
+}
+
+func (s *snapshotDocument) SetCommentLines(CommentPosition, ...string) Document {
+	return s
+}
+
+func (s *snapshotDocument) AppendCommentLine(CommentPosition, string) Document {
+	return s
+}
+
+func (s *snapshotDocument) StripComments() Document {
+	return s
+}
+
+func (s *snapshotDocument) SetCommentBefore(Path, ...string) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) SetCommentAfter(Path, ...string) error {
+	return ErrReadOnlySnapshot
+}
+
+func (s *snapshotDocument) SetBlankLinesBefore(Path, int) error {
+	return ErrReadOnlySnapshot
+}
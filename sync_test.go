@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncDocumentConcurrentAccess(t *testing.T) {
+	_, doc, err := yamlLoad(strings.TrimSpace(`
+# comment
+counter: 0
+items: []
+`))
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	syncDoc := NewSyncDocument(doc)
+
+	const writes = 50
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 1; i <= writes; i++ {
+			if _, err := syncDoc.SetKey("counter", i); err != nil {
+				t.Errorf("Failed to set counter: %v", err)
+			}
+
+			if _, err := syncDoc.SetAt(Path{"items", i - 1}, fmt.Sprintf("item-%d", i)); err != nil {
+				t.Errorf("Failed to append item: %v", err)
+			}
+		}
+	}()
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < writes; i++ {
+				// readers using the lock
+				counter := syncDoc.MustGet("counter").ToInt()
+				if counter < 0 || counter > writes {
+					t.Errorf("Invalid counter value %d.", counter)
+				}
+
+				if _, err := syncDoc.Bytes(0); err != nil {
+					t.Errorf("Failed to encode document: %v", err)
+				}
+
+				// readers using snapshots
+				snapshot := syncDoc.Snapshot()
+
+				items := snapshot.MustGet("items").ToSlice()
+				if counter := snapshot.MustGet("counter").ToInt(); len(items) != counter && len(items) != counter+1 {
+					t.Errorf("Snapshot is inconsistent: counter is %d, but there are %d items.", counter, len(items))
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if counter := syncDoc.MustGet("counter").ToInt(); counter != writes {
+		t.Fatalf("Expected counter to be %d, but got %d.", writes, counter)
+	}
+}
+
+func TestSyncDocumentSnapshot(t *testing.T) {
+	_, doc, err := yamlLoad("foo: bar")
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	syncDoc := NewSyncDocument(doc)
+
+	snapshot := syncDoc.Snapshot()
+	if syncDoc.Snapshot() != snapshot {
+		t.Fatal("Expected snapshot to be cached.")
+	}
+
+	if _, err := snapshot.SetKey("foo", "baz"); !errors.Is(err, ErrReadOnlySnapshot) {
+		t.Fatalf("Expected snapshot to be read-only, but got %v.", err)
+	}
+
+	err = syncDoc.Write(func(doc Document) error {
+		_, err := doc.SetKey("foo", "baz")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	if snapshot.MustGet("foo").ToString() != "bar" {
+		t.Fatal("Expected old snapshot to be unchanged.")
+	}
+
+	if syncDoc.Snapshot().MustGet("foo").ToString() != "baz" {
+		t.Fatal("Expected new snapshot to contain the change.")
+	}
+
+	// nodes returned by SyncDocument are copies
+	syncDoc.MustGet("foo").SetLineComment("ignored")
+
+	if syncDoc.MustGet("foo").LineComment() != "" {
+		t.Fatal("Expected returned nodes to be copies.")
+	}
+}
+
+func TestSyncDocumentSnapshotProtection(t *testing.T) {
+	_, doc, err := yamlLoad("metadata:\n  uid: 1234\n  name: test # yamled:readonly")
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	syncDoc := NewSyncDocument(doc)
+	if err := syncDoc.Protect("metadata.uid"); err != nil {
+		t.Fatalf("Failed to protect path: %v", err)
+	}
+
+	snapshot := syncDoc.Snapshot()
+
+	for _, path := range []Path{{"metadata", "uid"}, {"metadata", "name"}} {
+		if !snapshot.IsReadOnly(path) {
+			t.Errorf("Expected %v to be read-only in the snapshot.", path)
+		}
+	}
+
+	// unprotecting the document must not affect existing snapshots
+	syncDoc.Unprotect()
+
+	if !snapshot.IsReadOnly(Path{"metadata", "uid"}) {
+		t.Fatal("Expected snapshot to keep its protection.")
+	}
+
+	if syncDoc.Snapshot().IsReadOnly(Path{"metadata", "uid"}) {
+		t.Fatal("Expected new snapshot to not be protected anymore.")
+	}
+}
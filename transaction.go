@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Tx is the Document handed to the function given to
+// Document.Transaction(). All changes made through the Tx and the Node
+// and KeyNode objects obtained from it (e.g. from tx.Get()) are recorded
+// and rolled back; changes made to the underlying yaml.Nodes directly
+// are only recorded when made using Edit().
+type Tx interface {
+	Document
+
+	// Savepoint marks the current state of the transaction.
+	Savepoint() Savepoint
+	// RollbackTo undoes all changes made since the savepoint was
+	// created. The savepoint remains valid and can be rolled back
+	// to again.
+	RollbackTo(sp Savepoint) error
+}
+
+// Savepoint is a marker within a transaction, created by
+// Tx.Savepoint().
+type Savepoint struct {
+	tx       *transaction
+	position int
+}
+
+type transaction struct {
+	*document
+
+	// start is the journal position when the transaction began.
+	start int
+	done  bool
+}
+
+// Transaction runs fn and rolls back all changes made through tx if
+// fn returns an error or panics. Transactions can be nested, in which
+// case an inner rollback only undoes the inner transaction's changes.
+// Instead of copying the document, an undo journal is kept while the
+// transaction is running.
+func (d *document) Transaction(fn func(tx Tx) error) (err error) {
+	if d.journal == nil {
+		d.journal = &journal{}
+	}
+
+	tx := &transaction{
+		document: d,
+		start:    len(d.journal.operations),
+	}
+
+	d.journal.depth++
+
+	defer func() {
+		tx.done = true
+
+		if r := recover(); r != nil {
+			tx.finish(false)
+			panic(r)
+		}
+
+		if rollbackErr := tx.finish(err == nil); rollbackErr != nil {
+			err = fmt.Errorf("%w (additionally, rolling back failed: %v)", err, rollbackErr)
+		}
+	}()
+
+	return fn(tx)
+}
+
+// finish either keeps or rolls back the transaction's changes and
+// closes the journal if this was the outermost transaction.
+func (t *transaction) finish(commit bool) error {
+	var err error
+
+	if !commit {
+		err = t.rollback(t.start)
+	}
+
+	t.journal.depth--
+	if t.journal.depth == 0 {
+		ops := t.journal.operations
+		t.document.journal = nil
+
+		// a committed transaction is a single step in the history
+		t.record(ops)
+	}
+
+	return err
+}
+
+func (t *transaction) Savepoint() Savepoint {
+	return Savepoint{
+		tx:       t,
+		position: len(t.journal.operations),
+	}
+}
+
+func (t *transaction) RollbackTo(sp Savepoint) error {
+	if t.done {
+		return errors.New("transaction has already finished")
+	}
+
+	if sp.tx != t {
+		return errors.New("savepoint does not belong to this transaction")
+	}
+
+	if sp.position > len(t.journal.operations) {
+		return errors.New("savepoint has already been rolled back")
+	}
+
+	return t.rollback(sp.position)
+}
@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2023 Christoph Mewes
+// SPDX-License-Identifier: MIT
+
+package yamled
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const transactionTestInput = `
+# head comment
+name: web
+spec:
+  # the replicas
+  replicas: 3 # three
+  ports: [80, 443]
+list:
+  - a
+  - b
+`
+
+func TestTransactionRollback(t *testing.T) {
+	input := strings.TrimSpace(transactionTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	failure := errors.New("migration failed")
+
+	err = doc.Transaction(func(tx Tx) error {
+		if _, err := tx.SetAt(Path{"spec", "replicas"}, 5); err != nil {
+			return err
+		}
+
+		if _, err := tx.SetAt(Path{"spec", "resources", "cpu"}, "1"); err != nil {
+			return err
+		}
+
+		if _, err := tx.SetAt(Path{"list", 4}, "e"); err != nil {
+			return err
+		}
+
+		if _, err := tx.ReplaceAt(Path{"spec", "ports", "http", "port"}, 80); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteKey("spec", "ports"); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteKey("list", 0); err != nil {
+			return err
+		}
+
+		tx.SetHeadComment("changed")
+
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected transaction to return the function's error, but got %v.", err)
+	}
+
+	expectYAML(t, node, input)
+}
+
+func TestTransactionRollbackNodeChanges(t *testing.T) {
+	input := strings.TrimSpace(transactionTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	failure := errors.New("migration failed")
+
+	err = doc.Transaction(func(tx Tx) error {
+		spec := tx.MustGet("spec")
+
+		if _, err := spec.SetKey("replicas", 5); err != nil {
+			return err
+		}
+
+		if err := spec.DeleteKey("ports"); err != nil {
+			return err
+		}
+
+		if err := spec.SetStyle(yaml.FlowStyle); err != nil {
+			return err
+		}
+
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected transaction to return the function's error, but got %v.", err)
+	}
+
+	expectYAML(t, node, input)
+}
+
+func TestTransactionRollbackOnPanic(t *testing.T) {
+	input := strings.TrimSpace(transactionTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected panic to be passed through.")
+			}
+		}()
+
+		_ = doc.Transaction(func(tx Tx) error {
+			if err := tx.Set(map[string]string{"foo": "bar"}); err != nil {
+				return err
+			}
+
+			panic("oh no")
+		})
+	}()
+
+	expectYAML(t, node, input)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	input := strings.TrimSpace(transactionTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	err = doc.Transaction(func(tx Tx) error {
+		if _, err := tx.SetKey("name", "api"); err != nil {
+			return err
+		}
+
+		// a failing inner transaction only rolls back its own changes
+		_ = tx.Transaction(func(inner Tx) error {
+			if err := inner.DeleteKey("spec"); err != nil {
+				return err
+			}
+
+			return errors.New("inner failure")
+		})
+
+		return tx.DeleteKey("list", 1)
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+
+	expectYAML(t, node, `
+# head comment
+name: api
+spec:
+  # the replicas
+  replicas: 3 # three
+  ports: [80, 443]
+list:
+  - a
+`)
+}
+
+func TestTransactionSavepoints(t *testing.T) {
+	input := strings.TrimSpace(transactionTestInput)
+
+	node, doc, err := yamlLoad(input)
+	if err != nil {
+		t.Fatalf("Failed to load YAML: %v", err)
+	}
+
+	err = doc.Transaction(func(tx Tx) error {
+		if _, err := tx.SetAt(Path{"spec", "replicas"}, 5); err != nil {
+			return err
+		}
+
+		sp := tx.Savepoint()
+
+		if _, err := tx.SetAt(Path{"spec", "replicas"}, 7); err != nil {
+			return err
+		}
+
+		if _, err := tx.SetAt(Path{"spec", "new"}, true); err != nil {
+			return err
+		}
+
+		if err := tx.RollbackTo(sp); err != nil {
+			return err
+		}
+
+		_, err := tx.SetAt(Path{"list", 2}, "c")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+
+	expectYAML(t, node, `
+# head comment
+name: web
+spec:
+  # the replicas
+  replicas: 5
+  ports: [80, 443]
+list:
+  - a
+  - b
+  - c
+`)
+}
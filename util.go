@@ -80,3 +80,29 @@ func stringNode(value string) *yaml.Node {
 		Value: value,
 	}
 }
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+
+	return n
+}
+
+// rawNode returns the yaml.v3 node that is wrapped by a Node.
+func rawNode(n Node) *yaml.Node {
+	if asserted, ok := n.(*node); ok {
+		return asserted.node
+	}
+
+	marshalled, err := n.MarshalYAML()
+	if err != nil {
+		return nullNode()
+	}
+
+	if raw, ok := marshalled.(*yaml.Node); ok {
+		return raw
+	}
+
+	return nullNode()
+}